@@ -0,0 +1,133 @@
+package dht
+
+import (
+	"time"
+)
+
+// BanTTL is how long a first ban lasts. Each time a NodeID is banned again
+// before it is forgotten, the ban lasts twice as long, up to MaxBanTTL.
+var (
+	BanTTL    = time.Minute * 5
+	MaxBanTTL = time.Hour * 24
+)
+
+// Ban records why a NodeID was blacklisted and for how long.
+type Ban struct {
+	ID      NodeID
+	Reason  string
+	Created time.Time
+	TTL     time.Duration
+	// Count is the number of times the NodeID has been banned without being
+	// forgotten.
+	Count int
+}
+
+// Expires returns when the ban ends.
+func (b Ban) Expires() time.Time {
+	return b.Created.Add(b.TTL)
+}
+
+// Active returns true if the ban has not expired at the given time.
+func (b Ban) Active(at time.Time) bool {
+	return at.Before(b.Expires())
+}
+
+// forgotten returns true if the ban is no longer needed to escalate a repeat
+// offence. After a ban expires, the NodeID is on parole for the same length of
+// time as the ban.
+func (b Ban) forgotten(at time.Time) bool {
+	return !at.Before(b.Expires().Add(b.TTL))
+}
+
+// banTTL returns the TTL for a ban that is the count-th in a row.
+func banTTL(count int) time.Duration {
+	ttl := BanTTL
+	for i := 1; i < count && ttl < MaxBanTTL; i++ {
+		ttl *= 2
+	}
+	if ttl > MaxBanTTL {
+		ttl = MaxBanTTL
+	}
+	return ttl
+}
+
+func (n *Node) blacklisted(idStr string) bool {
+	b, _ := n.blacklist.get(idStr)
+	if b == nil {
+		return false
+	}
+	now := time.Now()
+	if b.Active(now) {
+		return true
+	}
+	if b.forgotten(now) {
+		n.blacklist.delete(idStr)
+	}
+	return false
+}
+
+// Ban removes the NodeID and adds it to the blacklist with the reason given. If
+// the NodeID is already banned or on parole from an earlier ban, the new ban
+// lasts twice as long as the last.
+func (n *Node) Ban(id NodeID, reason string) Ban {
+	n.tree.remove(id)
+	now := time.Now()
+	idStr := id.String()
+	b := &Ban{
+		ID:      id.Copy(),
+		Reason:  reason,
+		Created: now,
+		Count:   1,
+	}
+	n.blacklist.Lock()
+	if prev := n.blacklist.Map[idStr]; prev != nil && !prev.forgotten(now) {
+		b.Count = prev.Count + 1
+	}
+	b.TTL = banTTL(b.Count)
+	n.blacklist.Map[idStr] = b
+	n.blacklist.Unlock()
+	return *b
+}
+
+// liftBan ends an active ban now. The record is kept as if the ban had just
+// expired, so the NodeID is on parole and banning it again escalates.
+func (n *Node) liftBan(idStr string) {
+	now := time.Now()
+	n.blacklist.Lock()
+	if b := n.blacklist.Map[idStr]; b != nil && b.Active(now) {
+		b.Created = now.Add(-b.TTL)
+	}
+	n.blacklist.Unlock()
+}
+
+// Bans returns all the bans that are still active. Bans that have been
+// forgotten are removed.
+func (n *Node) Bans() []Ban {
+	now := time.Now()
+	var bans []Ban
+	var forgotten []string
+	n.blacklist.RLock()
+	for idStr, b := range n.blacklist.Map {
+		if b.Active(now) {
+			bans = append(bans, *b)
+		} else if b.forgotten(now) {
+			forgotten = append(forgotten, idStr)
+		}
+	}
+	n.blacklist.RUnlock()
+	n.blacklist.delete(forgotten...)
+	return bans
+}
+
+// Unban removes the NodeID from the blacklist, including any record of earlier
+// bans.
+func (n *Node) Unban(id NodeID) {
+	n.blacklist.delete(id.String())
+}
+
+// ClearBlacklist removes every entry from the blacklist.
+func (n *Node) ClearBlacklist() {
+	n.blacklist.Lock()
+	n.blacklist.Map = make(map[string]*Ban)
+	n.blacklist.Unlock()
+}
@@ -0,0 +1,85 @@
+package dht
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// age moves a ban back in time
+func (n *Node) age(id NodeID, d time.Duration) {
+	b, _ := n.blacklist.get(id.String())
+	cp := *b
+	cp.Created = cp.Created.Add(-d)
+	n.blacklist.set(id.String(), &cp)
+}
+
+func TestBan(t *testing.T) {
+	n := New([]byte{5, 4, 3}, 8, nil)
+	id := NodeID{128, 100, 123}
+	n.AddNodeID(id, false)
+
+	b := n.Ban(id, "testing")
+	assert.Equal(t, 0, n.KnownIDs())
+	assert.Equal(t, "testing", b.Reason)
+	assert.Equal(t, BanTTL, b.TTL)
+	assert.Equal(t, 1, b.Count)
+
+	n.AddNodeID(id, false)
+	assert.Equal(t, 0, n.KnownIDs())
+
+	bans := n.Bans()
+	assert.Len(t, bans, 1)
+	assert.Equal(t, id, bans[0].ID)
+
+	// after the ban expires the id can be added, but it's on parole
+	n.age(id, BanTTL)
+	assert.Len(t, n.Bans(), 0)
+	n.AddNodeID(id, false)
+	assert.Equal(t, 1, n.KnownIDs())
+
+	b = n.Ban(id, "again")
+	assert.Equal(t, 2, b.Count)
+	assert.Equal(t, 2*BanTTL, b.TTL)
+
+	// after parole, the ban is forgotten
+	n.age(id, 4*BanTTL)
+	n.Bans()
+	_, found := n.blacklist.get(id.String())
+	assert.False(t, found)
+	b = n.Ban(id, "forgotten")
+	assert.Equal(t, 1, b.Count)
+
+	n.Unban(id)
+	assert.Len(t, n.Bans(), 0)
+
+	n.RemoveNodeID(id, true)
+	n.RemoveNodeID(NodeID{1, 2, 3}, true)
+	assert.Len(t, n.Bans(), 2)
+	n.ClearBlacklist()
+	assert.Len(t, n.Bans(), 0)
+}
+
+func TestBanOverride(t *testing.T) {
+	n := New([]byte{5, 4, 3}, 8, nil)
+	id := NodeID{128, 100, 123}
+	n.Ban(id, "testing")
+	n.AddNodeID(id, true)
+	assert.Equal(t, 1, n.KnownIDs())
+	assert.Len(t, n.Bans(), 0)
+
+	// the override keeps the history, so the next ban escalates
+	b := n.Ban(id, "again")
+	assert.Equal(t, 2, b.Count)
+	assert.Equal(t, 2*BanTTL, b.TTL)
+	n.AddNodeID(id, true)
+	b = n.Ban(id, "and again")
+	assert.Equal(t, 3, b.Count)
+	assert.Equal(t, 4*BanTTL, b.TTL)
+}
+
+func TestBanTTL(t *testing.T) {
+	assert.Equal(t, BanTTL, banTTL(1))
+	assert.Equal(t, 4*BanTTL, banTTL(3))
+	assert.Equal(t, MaxBanTTL, banTTL(100))
+}
@@ -0,0 +1,166 @@
+package dht
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"time"
+)
+
+// MaxAddrs is the most addresses kept for a Contact.
+const MaxAddrs = 4
+
+// Contact holds what is known about a NodeID in the routing table; the
+// network addresses it can be reached at and it's liveness.
+type Contact struct {
+	ID NodeID
+	// Addrs are the addresses the contact can be reached at, the most recently
+	// learned first.
+	Addrs []netip.AddrPort
+	// LastSeen is the last time the contact was known to be alive. It is zero if
+	// the contact has only been learned about from other nodes.
+	LastSeen time.Time
+	// Failures is the number of consecutive requests to the contact that went
+	// unanswered.
+	Failures int
+	// RTT is the smoothed round trip time of requests to the contact.
+	RTT time.Duration
+	// Added is when the contact was added to the routing table.
+	Added time.Time
+	// Pinned contacts are never pruned or evicted, see Node.Pin.
+	Pinned bool
+}
+
+// rttWeight controls how quickly RTT follows new samples, each new sample
+// contributes 1/rttWeight.
+const rttWeight = 8
+
+// Contact returns the Contact for id and a bool indicating if it is in the
+// routing table.
+func (n *Node) Contact(id NodeID) (Contact, bool) {
+	return n.tree.contact(id)
+}
+
+// Seen records that the contact for id is alive. If rtt is greater than 0 it
+// is used to update the contact's RTT. It returns false if the id is not in the
+// routing table.
+func (n *Node) Seen(id NodeID, rtt time.Duration) bool {
+	now := time.Now()
+	return n.tree.update(id, func(c *Contact) {
+		c.seen(now, rtt)
+	})
+}
+
+// Failed records that a request to the contact for id went unanswered and
+// returns the number of consecutive failures.
+func (n *Node) Failed(id NodeID) int {
+	var failures int
+	n.tree.update(id, func(c *Contact) {
+		c.Failures++
+		failures = c.Failures
+	})
+	return failures
+}
+
+func (c *Contact) seen(at time.Time, rtt time.Duration) {
+	if at.After(c.LastSeen) {
+		c.LastSeen = at
+	}
+	c.Failures = 0
+	if rtt <= 0 {
+		return
+	}
+	if c.RTT == 0 {
+		c.RTT = rtt
+	} else {
+		c.RTT += (rtt - c.RTT) / rttWeight
+	}
+}
+
+// staler returns true if c should be evicted before c2. Contacts with more
+// failures are staler, then contacts that were seen less recently, then
+// contacts that were added more recently.
+func (c *Contact) staler(c2 *Contact) bool {
+	if c.Failures != c2.Failures {
+		return c.Failures > c2.Failures
+	}
+	if !c.LastSeen.Equal(c2.LastSeen) {
+		return c.LastSeen.Before(c2.LastSeen)
+	}
+	return c.Added.After(c2.Added)
+}
+
+// copy returns a copy of the Contact that does not share Addrs.
+func (c *Contact) copy() Contact {
+	cp := *c
+	if c.Addrs != nil {
+		cp.Addrs = make([]netip.AddrPort, len(c.Addrs))
+		copy(cp.Addrs, c.Addrs)
+	}
+	return cp
+}
+
+// addAddrs puts the addresses at the front of Addrs, removing duplicates and
+// keeping at most MaxAddrs.
+func (c *Contact) addAddrs(addrs []netip.AddrPort) {
+	if len(addrs) == 0 {
+		return
+	}
+	merged := make([]netip.AddrPort, 0, MaxAddrs)
+	for _, list := range [][]netip.AddrPort{addrs, c.Addrs} {
+		for _, a := range list {
+			if len(merged) == MaxAddrs {
+				break
+			}
+			if a.IsValid() && !containsAddr(merged, a) {
+				merged = append(merged, a)
+			}
+		}
+	}
+	c.Addrs = merged
+}
+
+func containsAddr(addrs []netip.AddrPort, a netip.AddrPort) bool {
+	for _, a2 := range addrs {
+		if a2 == a {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrBadAddrs is returned by UnmarshalAddrs if the data is not valid.
+var ErrBadAddrs = errors.New("bad address encoding")
+
+// MarshalAddrs encodes addresses compactly. Each address is the length of the
+// IP (4 or 16), the IP and the port as 2 bytes, big endian. IPv4 addresses
+// mapped into IPv6 are encoded as IPv4.
+func MarshalAddrs(addrs []netip.AddrPort) []byte {
+	b := make([]byte, 0, len(addrs)*19)
+	for _, a := range addrs {
+		if !a.IsValid() {
+			continue
+		}
+		ip := a.Addr().Unmap().AsSlice()
+		b = append(b, byte(len(ip)))
+		b = append(b, ip...)
+		b = binary.BigEndian.AppendUint16(b, a.Port())
+	}
+	return b
+}
+
+// UnmarshalAddrs decodes addresses encoded with MarshalAddrs.
+func UnmarshalAddrs(b []byte) ([]netip.AddrPort, error) {
+	var addrs []netip.AddrPort
+	for len(b) > 0 {
+		ln := int(b[0])
+		if (ln != 4 && ln != 16) || len(b) < ln+3 {
+			return nil, ErrBadAddrs
+		}
+		ip, _ := netip.AddrFromSlice(b[1 : ln+1])
+		port := binary.BigEndian.Uint16(b[ln+1:])
+		addrs = append(addrs, netip.AddrPortFrom(ip, port))
+		b = b[ln+3:]
+	}
+	return addrs, nil
+}
@@ -0,0 +1,107 @@
+package dht
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestContact(t *testing.T) {
+	n := New([]byte{5, 4, 3}, 8, nil)
+	id := NodeID{128, 100, 123}
+
+	_, ok := n.Contact(id)
+	assert.False(t, ok)
+	assert.False(t, n.Seen(id, time.Millisecond))
+	assert.Equal(t, 0, n.Failed(id))
+
+	n.AddNodeID(id, false)
+	c, ok := n.Contact(id)
+	assert.True(t, ok)
+	assert.Equal(t, id, c.ID)
+	assert.True(t, c.LastSeen.IsZero())
+
+	assert.Equal(t, 1, n.Failed(id))
+	assert.Equal(t, 2, n.Failed(id))
+
+	assert.True(t, n.Seen(id, 80*time.Millisecond))
+	c, _ = n.Contact(id)
+	assert.False(t, c.LastSeen.IsZero())
+	assert.Equal(t, 0, c.Failures)
+	assert.Equal(t, 80*time.Millisecond, c.RTT)
+
+	n.Seen(id, 160*time.Millisecond)
+	c, _ = n.Contact(id)
+	assert.Equal(t, 90*time.Millisecond, c.RTT)
+
+	n.Seen(id, 0)
+	c, _ = n.Contact(id)
+	assert.Equal(t, 90*time.Millisecond, c.RTT)
+
+	// Contact survives being pushed down the tree
+	n.AddNodeID(NodeID{129, 100, 123}, false)
+	c, ok = n.Contact(id)
+	assert.True(t, ok)
+	assert.Equal(t, 90*time.Millisecond, c.RTT)
+}
+
+func TestContactAddrs(t *testing.T) {
+	n := New([]byte{5, 4, 3}, 8, nil)
+	id := NodeID{128, 100, 123}
+	a1 := netip.MustParseAddrPort("10.0.0.1:5555")
+	a2 := netip.MustParseAddrPort("[2001:db8::1]:6666")
+
+	n.AddContact(Contact{ID: id, Addrs: []netip.AddrPort{a1, a1}}, false)
+	c, _ := n.Contact(id)
+	assert.Equal(t, []netip.AddrPort{a1}, c.Addrs)
+
+	n.AddContact(Contact{ID: id, Addrs: []netip.AddrPort{a2}}, false)
+	c, _ = n.Contact(id)
+	assert.Equal(t, []netip.AddrPort{a2, a1}, c.Addrs)
+
+	// returned contacts do not share addresses with the tree
+	c.Addrs[0] = a1
+	c, _ = n.Contact(id)
+	assert.Equal(t, a2, c.Addrs[0])
+
+	cs := n.SeekContacts(id, 5, false)
+	assert.Len(t, cs, 1)
+	assert.Equal(t, []netip.AddrPort{a2, a1}, cs[0].Addrs)
+
+	for i := 0; i < MaxAddrs+2; i++ {
+		a := netip.AddrPortFrom(netip.MustParseAddr("10.0.0.2"), uint16(i))
+		n.AddContact(Contact{ID: id, Addrs: []netip.AddrPort{a}}, false)
+	}
+	c, _ = n.Contact(id)
+	assert.Len(t, c.Addrs, MaxAddrs)
+	assert.Equal(t, uint16(MaxAddrs+1), c.Addrs[0].Port())
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, n.Snapshot(buf))
+	r := New([]byte{1, 1, 1}, 2, nil)
+	assert.NoError(t, r.Restore(buf))
+	rc, _ := r.Contact(id)
+	assert.Equal(t, c.Addrs, rc.Addrs)
+}
+
+func TestMarshalAddrs(t *testing.T) {
+	addrs := []netip.AddrPort{
+		netip.MustParseAddrPort("10.0.0.1:5555"),
+		netip.MustParseAddrPort("[2001:db8::1]:6666"),
+	}
+	b := MarshalAddrs(addrs)
+	assert.Len(t, b, 7+19)
+	out, err := UnmarshalAddrs(b)
+	assert.NoError(t, err)
+	assert.Equal(t, addrs, out)
+
+	mapped := netip.MustParseAddrPort("[::ffff:10.0.0.1]:5555")
+	assert.Len(t, MarshalAddrs([]netip.AddrPort{mapped}), 7)
+
+	_, err = UnmarshalAddrs(b[:len(b)-1])
+	assert.Equal(t, ErrBadAddrs, err)
+	_, err = UnmarshalAddrs([]byte{5, 1, 2, 3, 4, 5, 0, 0})
+	assert.Equal(t, ErrBadAddrs, err)
+}
@@ -0,0 +1,75 @@
+package dhtnetwork
+
+import (
+	"github.com/dist-ribut-us/dht"
+	"github.com/dist-ribut-us/serial"
+	"net/netip"
+)
+
+var contactPrefixLengths = []int{1, 0}
+
+// marshalContacts packs the ID and addresses of each contact. Only the first
+// dht.MaxAddrs addresses of a contact are included.
+func marshalContacts(cs []dht.Contact) ([]byte, error) {
+	data := make([][]byte, len(cs))
+	for i, c := range cs {
+		addrs := c.Addrs
+		if len(addrs) > dht.MaxAddrs {
+			addrs = addrs[:dht.MaxAddrs]
+		}
+		b, err := serial.MarshalByteSlices(contactPrefixLengths, [][]byte{
+			c.ID,
+			dht.MarshalAddrs(addrs),
+		})
+		if err != nil {
+			return nil, err
+		}
+		data[i] = b
+	}
+	return seekResponsePacker.Marshal(data)
+}
+
+// unmarshalContacts unpacks contacts packed by marshalContacts.
+func unmarshalContacts(b []byte) ([]dht.Contact, error) {
+	data, err := seekResponsePacker.Unmarshal(b)
+	if err != nil {
+		return nil, err
+	}
+	cs := make([]dht.Contact, len(data))
+	for i, cb := range data {
+		c, err := serial.UnmarshalByteSlices(contactPrefixLengths, cb)
+		if err != nil {
+			return nil, err
+		}
+		cs[i].ID = c[0]
+		if cs[i].Addrs, err = dht.UnmarshalAddrs(c[1]); err != nil {
+			return nil, err
+		}
+	}
+	return cs, nil
+}
+
+// addrBook holds addresses learned from responses for nodes that may not be in
+// the routing table.
+type addrBook map[string][]netip.AddrPort
+
+func (a addrBook) learn(cs []dht.Contact) {
+	for _, c := range cs {
+		if len(c.Addrs) > 0 {
+			a[c.ID.String()] = c.Addrs
+		}
+	}
+}
+
+// lookup returns the addresses for id from the addrBook or, if it isn't there,
+// from the routing table.
+func (a addrBook) lookup(n *Node, id dht.NodeID) []netip.AddrPort {
+	if addrs, ok := a[id.String()]; ok {
+		return addrs
+	}
+	if n == nil {
+		return nil
+	}
+	c, _ := n.Contact(id)
+	return c.Addrs
+}
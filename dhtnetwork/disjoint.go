@@ -0,0 +1,84 @@
+package dhtnetwork
+
+import (
+	"github.com/dist-ribut-us/dht"
+)
+
+// disjoint holds the per path state of a Seeker created with SeekDisjoint.
+type disjoint struct {
+	paths [][]dht.NodeID
+	// owner maps each NodeID to the only path it can be queried on.
+	owner   map[string]int
+	next    int
+	success int
+}
+
+// SeekDisjoint creates a Seeker that searches along d disjoint paths, as in
+// S/Kademlia. The initial candidates are split between the paths and a node is
+// only ever queried on the first path that learned about it, so a malicious
+// node can only steer the path it is on. The search succeeds if Accept returns
+// true for a response on any path. Alpha is raised to d if it is lower so that
+// every path can have a request in flight.
+func (n *Node) SeekDisjoint(target dht.NodeID, d int) *Seeker {
+	if d < 1 {
+		d = 1
+	}
+	s := n.Seek(target)
+	s.disjoint = &disjoint{
+		paths:   make([][]dht.NodeID, d),
+		owner:   make(map[string]int),
+		success: -1,
+	}
+	for i, id := range s.queue {
+		s.disjoint.add(i%d, s.target, id)
+	}
+	if s.Alpha < d {
+		s.Alpha = d
+	}
+	return s
+}
+
+// add queues id on the path unless it already belongs to a path.
+func (dj *disjoint) add(path int, target, id dht.NodeID) {
+	idStr := id.String()
+	if _, ok := dj.owner[idStr]; ok {
+		return
+	}
+	dj.owner[idStr] = path
+	dj.paths[path] = insert(dj.paths[path], target, id)
+}
+
+// nextID returns the closest unsent NodeID, taking the paths in turn.
+func (dj *disjoint) nextID(sent map[string]bool) dht.NodeID {
+	for i := range dj.paths {
+		q := dj.paths[(dj.next+i)%len(dj.paths)]
+		for j := 0; j < maxQueueDepth && j < len(q); j++ {
+			if id := q[j]; !sent[id.String()] {
+				return id
+			}
+		}
+	}
+	return nil
+}
+
+// Paths returns the number of disjoint paths, it is 0 unless the Seeker was
+// created with SeekDisjoint.
+func (s *Seeker) Paths() int {
+	s.RLock()
+	defer s.RUnlock()
+	if s.disjoint == nil {
+		return 0
+	}
+	return len(s.disjoint.paths)
+}
+
+// SuccessPath returns the path that the accepted response came from or -1 if
+// no path has succeeded.
+func (s *Seeker) SuccessPath() int {
+	s.RLock()
+	defer s.RUnlock()
+	if s.disjoint == nil {
+		return -1
+	}
+	return s.disjoint.success
+}
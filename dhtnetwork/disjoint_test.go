@@ -0,0 +1,78 @@
+package dhtnetwork
+
+import (
+	"github.com/dist-ribut-us/dht"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSeekDisjoint(t *testing.T) {
+	n := New([]byte{1, 10, 15}, 4, nil)
+	for _, id := range []dht.NodeID{{128, 0, 0}, {129, 0, 0}, {130, 0, 0}, {131, 0, 0}} {
+		n.AddNodeID(id, false)
+	}
+	target := dht.NodeID{128, 0, 1}
+
+	s := n.SeekDisjoint(target, 2)
+	s.SkipUpdate = true
+	s.Accept = Search(target)
+	assert.Equal(t, 2, s.Paths())
+	assert.Equal(t, -1, s.SuccessPath())
+
+	ok, id0, sr0 := s.Next()
+	assert.True(t, ok)
+	assert.Equal(t, dht.NodeID{128, 0, 0}, id0)
+	ok, id1, sr1 := s.Next()
+	assert.True(t, ok)
+	assert.Equal(t, dht.NodeID{129, 0, 0}, id1)
+
+	// {129, 0, 0} belongs to path 1 so it is not added to path 0
+	s.Handle(SeekResponse{
+		ID: sr0.ID,
+		Nodes: []dht.Contact{
+			{ID: dht.NodeID{129, 0, 0}},
+			{ID: dht.NodeID{128, 0, 2}},
+		},
+	})
+	assert.Equal(t, []dht.NodeID{{128, 0, 0}, {128, 0, 2}, {130, 0, 0}}, s.disjoint.paths[0])
+	assert.Equal(t, []dht.NodeID{{129, 0, 0}, {131, 0, 0}}, s.disjoint.paths[1])
+
+	s.Handle(SeekResponse{
+		ID:    sr1.ID,
+		Nodes: []dht.Contact{{ID: target}},
+	})
+	assert.Equal(t, Accepted, s.Reason())
+	assert.Equal(t, 1, s.SuccessPath())
+}
+
+func TestSeekDisjointQueriesOnce(t *testing.T) {
+	n := New([]byte{1, 10, 15}, 4, nil)
+	for _, id := range []dht.NodeID{{128, 0, 0}, {129, 0, 0}, {130, 0, 0}} {
+		n.AddNodeID(id, false)
+	}
+
+	s := n.SeekDisjoint(dht.NodeID{128, 0, 1}, 3)
+	s.SkipUpdate = true
+	s.StallRounds = 0
+	queried := make(map[string]int)
+	for !s.Done() {
+		ok, id, sr := s.Next()
+		if !assert.True(t, ok) {
+			return
+		}
+		queried[id.String()]++
+		// every node claims to know every other node
+		s.Handle(SeekResponse{
+			ID: sr.ID,
+			Nodes: []dht.Contact{
+				{ID: dht.NodeID{128, 0, 0}},
+				{ID: dht.NodeID{129, 0, 0}},
+				{ID: dht.NodeID{130, 0, 0}},
+			},
+		})
+	}
+	assert.Len(t, queried, 3)
+	for _, c := range queried {
+		assert.Equal(t, 1, c)
+	}
+}
@@ -0,0 +1,150 @@
+package dhtnetwork
+
+import (
+	"errors"
+)
+
+// ProtocolVersion is written to every Envelope. Packets with any other version
+// are rejected by Decode. Version 2 added signatures to the messages, which
+// changed their layout.
+const ProtocolVersion byte = 2
+
+// MessageType identifies the message held in an Envelope.
+type MessageType byte
+
+// Message types
+const (
+	SeekRequestType MessageType = iota + 1
+	SeekResponseType
+	StoreRequestType
+	StoreResponseType
+	FindValueRequestType
+	FindValueResponseType
+	PingType
+	PongType
+	LeaveType
+)
+
+// Errors returned by Encode and Decode
+var (
+	ErrShortPacket    = errors.New("packet is too short to hold an envelope")
+	ErrUnknownVersion = errors.New("unknown protocol version")
+	ErrUnknownType    = errors.New("unknown message type")
+)
+
+// Message is any of the messages that can be sent between nodes.
+type Message interface {
+	Marshal() ([]byte, error)
+	Unmarshal([]byte) error
+}
+
+var messageTypes = map[MessageType]func() Message{
+	SeekRequestType:       func() Message { return &SeekRequest{} },
+	SeekResponseType:      func() Message { return &SeekResponse{} },
+	StoreRequestType:      func() Message { return &StoreRequest{} },
+	StoreResponseType:     func() Message { return &StoreResponse{} },
+	FindValueRequestType:  func() Message { return &FindValueRequest{} },
+	FindValueResponseType: func() Message { return &FindValueResponse{} },
+	PingType:              func() Message { return &Ping{} },
+	PongType:              func() Message { return &Pong{} },
+	LeaveType:             func() Message { return &Leave{} },
+}
+
+// TypeOf returns the MessageType of a message or 0 if it is not a known type.
+func TypeOf(msg Message) MessageType {
+	switch msg.(type) {
+	case *SeekRequest:
+		return SeekRequestType
+	case *SeekResponse:
+		return SeekResponseType
+	case *StoreRequest:
+		return StoreRequestType
+	case *StoreResponse:
+		return StoreResponseType
+	case *FindValueRequest:
+		return FindValueRequestType
+	case *FindValueResponse:
+		return FindValueResponseType
+	case *Ping:
+		return PingType
+	case *Pong:
+		return PongType
+	case *Leave:
+		return LeaveType
+	}
+	return 0
+}
+
+// Envelope wraps every packet. It is encoded as a version byte, a type byte and
+// a flags byte followed by the body.
+type Envelope struct {
+	Version byte
+	Type    MessageType
+	Flags   byte
+	Body    []byte
+}
+
+const envelopeHeader = 3
+
+// Marshal the envelope to a packet.
+func (e Envelope) Marshal() []byte {
+	b := make([]byte, envelopeHeader+len(e.Body))
+	b[0] = e.Version
+	b[1] = byte(e.Type)
+	b[2] = e.Flags
+	copy(b[envelopeHeader:], e.Body)
+	return b
+}
+
+// UnmarshalEnvelope reads the envelope from a packet. The body is not decoded.
+func UnmarshalEnvelope(b []byte) (Envelope, error) {
+	if len(b) < envelopeHeader {
+		return Envelope{}, ErrShortPacket
+	}
+	e := Envelope{
+		Version: b[0],
+		Type:    MessageType(b[1]),
+		Flags:   b[2],
+		Body:    b[envelopeHeader:],
+	}
+	if e.Version != ProtocolVersion {
+		return e, ErrUnknownVersion
+	}
+	return e, nil
+}
+
+// Encode wraps the message in an Envelope with the current ProtocolVersion.
+func Encode(msg Message, flags byte) ([]byte, error) {
+	t := TypeOf(msg)
+	if t == 0 {
+		return nil, ErrUnknownType
+	}
+	body, err := msg.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return Envelope{
+		Version: ProtocolVersion,
+		Type:    t,
+		Flags:   flags,
+		Body:    body,
+	}.Marshal(), nil
+}
+
+// Decode a packet into the message it holds. The message will be a pointer to
+// one of the message types, such as *SeekRequest.
+func Decode(b []byte) (Message, Envelope, error) {
+	e, err := UnmarshalEnvelope(b)
+	if err != nil {
+		return nil, e, err
+	}
+	fn, ok := messageTypes[e.Type]
+	if !ok {
+		return nil, e, ErrUnknownType
+	}
+	msg := fn()
+	if err = msg.Unmarshal(e.Body); err != nil {
+		return nil, e, err
+	}
+	return msg, e, nil
+}
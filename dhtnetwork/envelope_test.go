@@ -0,0 +1,62 @@
+package dhtnetwork
+
+import (
+	"github.com/dist-ribut-us/dht"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	msgs := []Message{
+		&SeekRequest{
+			ID:     []byte{1, 2, 3},
+			From:   dht.NodeID{4, 5, 6},
+			Target: dht.NodeID{7, 8, 9},
+		},
+		&StoreRequest{
+			ID:    []byte{1, 2, 3},
+			From:  dht.NodeID{4, 5, 6},
+			Key:   dht.NodeID{7, 8, 9},
+			Value: []byte("value"),
+		},
+		&FindValueResponse{
+			ID:    []byte{1, 2, 3},
+			Value: []byte("value"),
+			Nodes: []dht.Contact{},
+		},
+	}
+	for _, msg := range msgs {
+		b, err := Encode(msg, 5)
+		assert.NoError(t, err)
+		got, e, err := Decode(b)
+		assert.NoError(t, err)
+		assert.Equal(t, ProtocolVersion, e.Version)
+		assert.Equal(t, TypeOf(msg), e.Type)
+		assert.Equal(t, byte(5), e.Flags)
+		assert.Equal(t, msg, got)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	_, _, err := Decode([]byte{ProtocolVersion, 1})
+	assert.Equal(t, ErrShortPacket, err)
+
+	_, _, err = Decode([]byte{ProtocolVersion + 1, byte(SeekRequestType), 0})
+	assert.Equal(t, ErrUnknownVersion, err)
+
+	_, _, err = Decode([]byte{ProtocolVersion, 200, 0})
+	assert.Equal(t, ErrUnknownType, err)
+
+	_, err = Encode(nil, 0)
+	assert.Equal(t, ErrUnknownType, err)
+}
+
+func TestDecodeVersion1(t *testing.T) {
+	// version 1 packets have a different layout and are rejected rather than
+	// misread
+	b, err := Encode(&SeekRequest{ID: []byte{1}, From: dht.NodeID{1, 2, 3}}, 0)
+	assert.NoError(t, err)
+	b[0] = 1
+	_, _, err = Decode(b)
+	assert.Equal(t, ErrUnknownVersion, err)
+}
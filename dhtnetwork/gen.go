@@ -0,0 +1,37 @@
+package dhtnetwork
+
+import (
+  "sync"
+)
+
+type records struct {
+	Map map[string][]byte
+	sync.RWMutex
+}
+
+func newrecords() *records {
+	return &records{
+		Map: make(map[string][]byte),
+	}
+}
+
+func (t *records) get(key string) ([]byte, bool) {
+	t.RLock()
+	k, b := t.Map[key]
+	t.RUnlock()
+	return k, b
+}
+
+func (t *records) set(key string, val []byte) {
+	t.Lock()
+	t.Map[key] = val
+	t.Unlock()
+}
+
+func (t *records) delete(keys ...string) {
+	t.Lock()
+	for _, key := range keys {
+		delete(t.Map, key)
+	}
+	t.Unlock()
+}
\ No newline at end of file
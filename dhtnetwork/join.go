@@ -0,0 +1,130 @@
+package dhtnetwork
+
+import (
+	"context"
+	"errors"
+	"github.com/dist-ribut-us/dht"
+	"time"
+)
+
+// ErrNoSeeds is returned by Join when it is not given any seeds.
+var ErrNoSeeds = errors.New("no seeds to join from")
+
+// ErrJoinFailed is returned by Join when no seed responded after JoinRetries
+// attempts.
+var ErrJoinFailed = errors.New("could not reach any seed")
+
+// JoinRetries is the number of times Join tries to reach the seeds.
+var JoinRetries = 5
+
+// JoinBackoff is how long Join waits after the first failed attempt, it doubles
+// with each attempt up to MaxJoinBackoff.
+var JoinBackoff = time.Second
+
+// MaxJoinBackoff is the longest Join waits between attempts.
+var MaxJoinBackoff = time.Minute
+
+// JoinStage is the stage of a Join.
+type JoinStage byte
+
+// Join stages
+const (
+	// JoinSelfLookup is a lookup for the Node's own ID through the seeds.
+	JoinSelfLookup JoinStage = iota
+	// JoinRetry means no seed responded and Join is waiting before trying
+	// again.
+	JoinRetry
+	// JoinRefresh is the refresh of the buckets farther away than the closest
+	// neighbour.
+	JoinRefresh
+	// JoinDone means the Node has joined the network.
+	JoinDone
+	// JoinFailed means no seed responded after JoinRetries attempts.
+	JoinFailed
+)
+
+var joinStageStrings = []string{"self lookup", "retry", "refresh", "done", "failed"}
+
+func (j JoinStage) String() string {
+	if int(j) < len(joinStageStrings) {
+		return joinStageStrings[j]
+	}
+	return "unknown"
+}
+
+// JoinProgress is passed to the progress func of Join at each stage.
+type JoinProgress struct {
+	Stage   JoinStage
+	Attempt int
+	// Known is the number of NodeIDs in the routing table.
+	Known int
+	// Wait is how long Join will wait before the next attempt, it is only set
+	// for JoinRetry.
+	Wait time.Duration
+	Err  error
+}
+
+// Join the network through the seeds using the Node's Transport. It looks up
+// the Node's own ID, which introduces it to it's neighbours, and then
+// refreshes the buckets farther away than the closest neighbour. If no seed
+// responds, it retries with backoff. If progress is not nil it is called at
+// each stage.
+func (n *Node) Join(ctx context.Context, seeds []dht.Contact, progress func(JoinProgress)) error {
+	return n.JoinWith(ctx, seeds, progress, n.Run)
+}
+
+// JoinWith is the same as Join but uses run to run the lookups. This allows
+// joining without a Transport, for instance with RPC.Run and a SendFunc.
+func (n *Node) JoinWith(ctx context.Context, seeds []dht.Contact, progress func(JoinProgress), run func(context.Context, Lookup) error) error {
+	if len(seeds) == 0 {
+		return ErrNoSeeds
+	}
+	report := func(p JoinProgress) {
+		if progress != nil {
+			p.Known = n.KnownIDs()
+			progress(p)
+		}
+	}
+
+	backoff := JoinBackoff
+	for attempt := 1; ; attempt++ {
+		report(JoinProgress{Stage: JoinSelfLookup, Attempt: attempt})
+		for _, c := range seeds {
+			n.AddContact(c, true)
+		}
+		s := n.FindClosest(n.ID(), DefaultK)
+		if err := run(ctx, s); err != nil {
+			return err
+		}
+		// the Seeker's own response counts as one success
+		if _, successes := s.Counts(); successes > 1 {
+			break
+		}
+		if attempt >= JoinRetries {
+			report(JoinProgress{Stage: JoinFailed, Attempt: attempt, Err: ErrJoinFailed})
+			return ErrJoinFailed
+		}
+		report(JoinProgress{Stage: JoinRetry, Attempt: attempt, Wait: backoff})
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if backoff *= 2; backoff > MaxJoinBackoff {
+			backoff = MaxJoinBackoff
+		}
+	}
+
+	report(JoinProgress{Stage: JoinRefresh})
+	if closest := n.SeekN(n.ID(), 1, false); len(closest) > 0 {
+		var indexes []int
+		for idx := 0; idx < n.bucketIndex(closest[0]); idx++ {
+			indexes = append(indexes, idx)
+		}
+		if err := run(ctx, n.UpdateIndexes(indexes)); err != nil {
+			return err
+		}
+	}
+	report(JoinProgress{Stage: JoinDone})
+	return nil
+}
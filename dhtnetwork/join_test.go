@@ -0,0 +1,91 @@
+package dhtnetwork
+
+import (
+	"context"
+	"errors"
+	"github.com/dist-ribut-us/dht"
+	"github.com/stretchr/testify/assert"
+	mr "math/rand"
+	"testing"
+	"time"
+)
+
+func TestJoin(t *testing.T) {
+	r := mr.New(mr.NewSource(1618))
+	nodes := make(map[string]*Node)
+	var ids []dht.NodeID
+	for i := 0; i < 30; i++ {
+		id := make([]byte, 4)
+		r.Read(id)
+		n := New(id, 4, nil)
+		nodes[n.ID().String()] = n
+		ids = append(ids, n.ID())
+	}
+	for _, n := range nodes {
+		for _, id := range ids {
+			n.AddNodeID(id, false)
+		}
+	}
+
+	joiner := New([]byte{1, 2, 3, 4}, 4, nil)
+	rpc := NewRPC(time.Millisecond * 10)
+	run := func(ctx context.Context, l Lookup) error {
+		return rpc.Run(ctx, l, func(id dht.NodeID, sr SeekRequest) error {
+			to, ok := nodes[id.String()]
+			if !ok {
+				return errors.New("unknown node")
+			}
+			resp, _ := to.HandleSeek(sr)
+			go rpc.Respond(sr.ID, resp)
+			return nil
+		})
+	}
+
+	var stages []JoinStage
+	err := joiner.JoinWith(context.Background(), []dht.Contact{{ID: ids[0]}}, func(p JoinProgress) {
+		stages = append(stages, p.Stage)
+	}, run)
+	assert.NoError(t, err)
+	assert.Equal(t, []JoinStage{JoinSelfLookup, JoinRefresh, JoinDone}, stages)
+	assert.True(t, joiner.KnownIDs() > 1)
+
+	// the closest node to the joiner learned about it
+	closest := ids[0]
+	for _, id := range ids {
+		if id.Xor(joiner.ID()).Compare(closest.Xor(joiner.ID())) == -1 {
+			closest = id
+		}
+	}
+	_, ok := nodes[closest.String()].Contact(joiner.ID())
+	assert.True(t, ok)
+}
+
+func TestJoinRetry(t *testing.T) {
+	defer func(r int, b time.Duration) {
+		JoinRetries, JoinBackoff = r, b
+	}(JoinRetries, JoinBackoff)
+	JoinRetries, JoinBackoff = 3, time.Millisecond
+
+	n := New([]byte{1, 2, 3, 4}, 4, nil)
+	rpc := NewRPC(time.Millisecond)
+	run := func(ctx context.Context, l Lookup) error {
+		return rpc.Run(ctx, l, func(id dht.NodeID, sr SeekRequest) error {
+			return errors.New("unreachable")
+		})
+	}
+
+	var ps []JoinProgress
+	err := n.JoinWith(context.Background(), []dht.Contact{{ID: dht.NodeID{200, 0, 0, 0}}}, func(p JoinProgress) {
+		ps = append(ps, p)
+	}, run)
+	assert.Equal(t, ErrJoinFailed, err)
+	if assert.Len(t, ps, 6) {
+		assert.Equal(t, JoinRetry, ps[1].Stage)
+		assert.Equal(t, time.Millisecond, ps[1].Wait)
+		assert.Equal(t, time.Millisecond*2, ps[3].Wait)
+		assert.Equal(t, JoinFailed, ps[5].Stage)
+		assert.Equal(t, 3, ps[5].Attempt)
+	}
+
+	assert.Equal(t, ErrNoSeeds, n.Join(context.Background(), nil, nil))
+}
@@ -0,0 +1,129 @@
+package dhtnetwork
+
+import (
+	"errors"
+	"github.com/dist-ribut-us/dht"
+	"github.com/dist-ribut-us/serial"
+	"net/netip"
+)
+
+// DefaultLeaveNeighbours is the number of closest neighbours Leave notifies.
+var DefaultLeaveNeighbours = 8
+
+// Leave tells a node that the sender is leaving the network.
+type Leave struct {
+	ID   []byte
+	From dht.NodeID
+	// Node the Leave is sent to and the Unix time it was signed at.
+	To   dht.NodeID
+	Time int64
+	// Public and Sig are set by Sign, they are empty if the Leave is unsigned.
+	Public []byte
+	Sig    []byte
+}
+
+var leavePrefixLengths = []int{2, 2, 2, -8, 1, 0}
+
+// Marshal serializes the Leave
+func (l *Leave) Marshal() ([]byte, error) {
+	data := [][]byte{
+		l.ID,
+		l.From,
+		l.To,
+		marshalTime(l.Time),
+		l.Public,
+		l.Sig,
+	}
+	return serial.MarshalByteSlices(leavePrefixLengths, data)
+}
+
+// Unmarshal deserializes the Leave
+func (l *Leave) Unmarshal(b []byte) error {
+	data, err := serial.UnmarshalByteSlices(leavePrefixLengths, b)
+	if err != nil {
+		return err
+	}
+	l.ID = data[0]
+	l.From = data[1]
+	l.To = orNil(data[2])
+	l.Time = unmarshalTime(data[3])
+	l.Public = orNil(data[4])
+	l.Sig = orNil(data[5])
+	return nil
+}
+
+// HandleLeave removes the node that sent the Leave from the routing table. It
+// is not blacklisted so it can rejoin later. The Leave is only trusted if it
+// is accepted by the signature policy and was sent from one of the addresses
+// known for the node, otherwise anyone could remove any node.
+func (n *Node) HandleLeave(l Leave, from netip.AddrPort) {
+	if len(l.From) != n.IDlen || !n.acceptsRequest(&l, l.ID, l.To, l.Time) {
+		return
+	}
+	c, ok := n.Contact(l.From)
+	if !ok {
+		return
+	}
+	for _, addr := range c.Addrs {
+		if addr == from {
+			n.RemoveNodeID(l.From, false)
+			return
+		}
+	}
+}
+
+// Leave sends a Leave to the Node's closest neighbours, DefaultLeaveNeighbours
+// of them if neighbours is less than 1. If handoff is true, each record the
+// Node holds is first sent in a StoreRequest to the closest neighbour to it's
+// key. No responses are waited on. The errors from any messages that could not
+// be sent are returned together.
+func (n *Node) Leave(neighbours int, handoff bool) error {
+	if n.Transport == nil {
+		return ErrNoTransport
+	}
+	if neighbours < 1 {
+		neighbours = DefaultLeaveNeighbours
+	}
+	var errs []error
+	send := func(msg Message, c dht.Contact) {
+		if len(c.Addrs) == 0 {
+			errs = append(errs, ErrNoAddrs)
+			return
+		}
+		if err := n.Send(msg, c.Addrs[0]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if handoff {
+		n.records.RLock()
+		records := make(map[string][]byte, len(n.records.Map))
+		for k, v := range n.records.Map {
+			records[k] = v
+		}
+		n.records.RUnlock()
+		for k, v := range records {
+			key, err := decodeString(k)
+			if err != nil {
+				continue
+			}
+			cs := n.SeekContacts(key, 1, false)
+			if len(cs) == 0 {
+				continue
+			}
+			sr := n.StoreRequest(cs[0].ID, key, v)
+			send(&sr, cs[0])
+		}
+	}
+
+	for _, c := range n.SeekContacts(n.ID(), neighbours, false) {
+		l := Leave{
+			ID:   NewRequestID(),
+			From: n.ID(),
+			To:   c.ID,
+		}
+		n.sign(&l)
+		send(&l, c)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,64 @@
+package dhtnetwork
+
+import (
+	"github.com/dist-ribut-us/dht"
+	"github.com/stretchr/testify/assert"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestHandleLeave(t *testing.T) {
+	n := New([]byte{1, 10, 15}, 4, nil)
+	id := dht.NodeID{128, 10, 15}
+	addr := netip.MustParseAddrPort("10.0.0.1:5555")
+	n.AddContact(dht.Contact{ID: id, Addrs: []netip.AddrPort{addr}}, false)
+
+	// a Leave from any other address is ignored
+	n.HandleLeave(Leave{From: id}, netip.MustParseAddrPort("10.0.0.2:5555"))
+	_, ok := n.Contact(id)
+	assert.True(t, ok)
+
+	n.HandleLeave(Leave{From: id}, addr)
+	_, ok = n.Contact(id)
+	assert.False(t, ok)
+
+	// it is not blacklisted so it can rejoin
+	n.AddNodeID(id, false)
+	_, ok = n.Contact(id)
+	assert.True(t, ok)
+}
+
+func TestLeaveUDP(t *testing.T) {
+	a := New([]byte{1, 10, 15}, 4, nil)
+	b := New([]byte{200, 10, 15}, 4, nil)
+	key := dht.NodeID{201, 0, 0}
+	a.Store(key, []byte("value"))
+
+	addrs := make(map[*Node]netip.AddrPort)
+	for _, n := range []*Node{a, b} {
+		tr, err := ListenUDP("127.0.0.1:0")
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer tr.Close()
+		n.SetTransport(tr)
+		addrs[n] = tr.Addr()
+		go n.Serve()
+	}
+	a.AddContact(dht.Contact{ID: b.ID(), Addrs: []netip.AddrPort{addrs[b]}}, false)
+	b.AddContact(dht.Contact{ID: a.ID(), Addrs: []netip.AddrPort{addrs[a]}}, false)
+
+	assert.NoError(t, a.Leave(0, true))
+	for i := 0; i < 100; i++ {
+		if _, ok := b.Contact(a.ID()); !ok {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	_, ok := b.Contact(a.ID())
+	assert.False(t, ok)
+	v, ok := b.Value(key)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("value"), v)
+}
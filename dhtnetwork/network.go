@@ -3,9 +3,14 @@ package dhtnetwork
 import (
 	"encoding/base64"
 	"github.com/dist-ribut-us/dht"
+	"net/netip"
+	"time"
 )
 
-var encodeToString = base64.URLEncoding.EncodeToString
+var (
+	encodeToString = base64.URLEncoding.EncodeToString
+	decodeString   = base64.URLEncoding.DecodeString
+)
 
 // Node is our local node in a distributed hash table network.
 type Node struct {
@@ -13,13 +18,48 @@ type Node struct {
 	ReturnNodes       int
 	SkipRequestUpdate bool
 	IDlen             int
+	// Transport is used by Send and Serve, it can be nil if the Node is not
+	// sending messages itself. It should be set with SetTransport.
+	Transport Transport
+	// RPC matches the responses received by Serve to the requests waiting on
+	// them.
+	RPC *RPC
+	// Identity, if set, signs the SeekRequests and SeekResponses the Node
+	// sends. It's ID should be the Node's ID.
+	Identity *dht.Identity
+	// RequireSignatures drops SeekRequests and SeekResponses that are not
+	// signed. Badly signed messages are always dropped.
+	RequireSignatures bool
+	// OnSendError, if set, is called by Serve with any error sending a response
+	// and the address it was for.
+	OnSendError func(err error, to netip.AddrPort)
+	records     *records
+	touched     *touched
+	replays     *replays
 }
 
-// New creates an instance of Network
-func New(self []byte, startBuffers int) *Node {
-	return &Node{
-		Node:        dht.New(self, startBuffers),
+// New creates an instance of Network. The policy is passed to dht.New.
+func New(self []byte, startBuffers int, policy dht.EvictionPolicy) *Node {
+	n := &Node{
+		Node:        dht.New(self, startBuffers, policy),
 		ReturnNodes: 5,
 		IDlen:       len(self),
+		records:     newrecords(),
+		RPC:         NewRPC(0),
+		touched:     newTouched(len(self) * 8),
+		replays:     newReplays(),
+	}
+	return n
+}
+
+// learn adds a node that sent a request to the routing table and marks it as
+// seen.
+func (n *Node) learn(id dht.NodeID) {
+	if n.SkipRequestUpdate {
+		return
 	}
+	n.AddContact(dht.Contact{
+		ID:       id,
+		LastSeen: time.Now(),
+	}, true)
 }
@@ -0,0 +1,139 @@
+package dhtnetwork
+
+import (
+	"context"
+	"errors"
+	"github.com/dist-ribut-us/dht"
+	"github.com/dist-ribut-us/serial"
+	"time"
+)
+
+// ErrNoPong is returned by Ping when no Pong comes back from the contact.
+var ErrNoPong = errors.New("no pong")
+
+// Ping checks that a node is alive.
+type Ping struct {
+	ID   []byte
+	From dht.NodeID
+	// Node the Ping is sent to and the Unix time it was signed at.
+	To   dht.NodeID
+	Time int64
+	// Public and Sig are set by Sign, they are empty if the Ping is unsigned.
+	Public []byte
+	Sig    []byte
+}
+
+var pingPrefixLengths = []int{2, 2, 2, -8, 1, 0}
+
+// Marshal serializes the Ping
+func (p *Ping) Marshal() ([]byte, error) {
+	data := [][]byte{
+		p.ID,
+		p.From,
+		p.To,
+		marshalTime(p.Time),
+		p.Public,
+		p.Sig,
+	}
+	return serial.MarshalByteSlices(pingPrefixLengths, data)
+}
+
+// Unmarshal deserializes the Ping
+func (p *Ping) Unmarshal(b []byte) error {
+	data, err := serial.UnmarshalByteSlices(pingPrefixLengths, b)
+	if err != nil {
+		return err
+	}
+	p.ID = data[0]
+	p.From = data[1]
+	p.To = orNil(data[2])
+	p.Time = unmarshalTime(data[3])
+	p.Public = orNil(data[4])
+	p.Sig = orNil(data[5])
+	return nil
+}
+
+// Pong is the response to a Ping.
+type Pong struct {
+	ID   []byte
+	From dht.NodeID
+}
+
+var pongPrefixLengths = []int{2, 0}
+
+// Marshal serializes the Pong
+func (p *Pong) Marshal() ([]byte, error) {
+	return serial.MarshalByteSlices(pongPrefixLengths, [][]byte{p.ID, p.From})
+}
+
+// Unmarshal deserializes the Pong
+func (p *Pong) Unmarshal(b []byte) error {
+	data, err := serial.UnmarshalByteSlices(pongPrefixLengths, b)
+	if err != nil {
+		return err
+	}
+	p.ID = data[0]
+	p.From = data[1]
+	return nil
+}
+
+// HandlePing returns a Pong. The node that sent the Ping is learned if the
+// Ping is accepted by the signature policy.
+func (n *Node) HandlePing(p Ping) Pong {
+	if n.acceptsRequest(&p, p.ID, p.To, p.Time) {
+		n.learn(p.From)
+	}
+	return n.pong(p)
+}
+
+func (n *Node) pong(p Ping) Pong {
+	return Pong{
+		ID:   p.ID,
+		From: n.ID(),
+	}
+}
+
+// Ping sends a Ping to the contact's first address and waits for the Pong. If
+// it arrives, the contact is marked as seen.
+func (n *Node) Ping(ctx context.Context, c dht.Contact) error {
+	if n.Transport == nil {
+		return ErrNoTransport
+	}
+	if len(c.Addrs) == 0 {
+		return ErrNoAddrs
+	}
+	p := Ping{
+		ID:   NewRequestID(),
+		From: n.ID(),
+		To:   c.ID,
+	}
+	n.sign(&p)
+	got := make(chan bool, 1)
+	n.RPC.Request(ctx, p.ID, func(resp interface{}) {
+		pong, ok := resp.(Pong)
+		got <- ok && pong.From.Equal(c.ID)
+	}, func() {
+		got <- false
+	})
+	sent := time.Now()
+	if err := n.Send(&p, c.Addrs[0]); err != nil {
+		n.RPC.Cancel(p.ID)
+		return err
+	}
+	select {
+	case ok := <-got:
+		if !ok {
+			return ErrNoPong
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	n.Seen(c.ID, time.Since(sent))
+	return nil
+}
+
+// Alive pings the contact and returns true if it answered. It is used as the
+// Verify hook on the routing table so that live contacts are not evicted.
+func (n *Node) Alive(c dht.Contact) bool {
+	return n.Ping(context.Background(), c) == nil
+}
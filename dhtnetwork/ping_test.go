@@ -0,0 +1,71 @@
+package dhtnetwork
+
+import (
+	"context"
+	"github.com/dist-ribut-us/dht"
+	"github.com/stretchr/testify/assert"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestPingMarshal(t *testing.T) {
+	p := &Ping{
+		ID:   []byte{1, 2, 3},
+		From: dht.NodeID{4, 5, 6},
+	}
+	b, err := Encode(p, 0)
+	assert.NoError(t, err)
+	got, _, err := Decode(b)
+	assert.NoError(t, err)
+	assert.Equal(t, p, got)
+}
+
+func TestHandlePing(t *testing.T) {
+	n := New([]byte{1, 10, 15}, 4, nil)
+	from := dht.NodeID{128, 111, 222}
+	pong := n.HandlePing(Ping{
+		ID:   []byte{1, 2, 3},
+		From: from,
+	})
+	assert.Equal(t, []byte{1, 2, 3}, pong.ID)
+	assert.Equal(t, n.ID(), pong.From)
+	_, ok := n.Contact(from)
+	assert.True(t, ok)
+}
+
+func TestPingUDP(t *testing.T) {
+	a := New([]byte{1, 10, 15}, 4, nil)
+	b := New([]byte{200, 10, 15}, 4, nil)
+	a.RPC.Timeout = time.Millisecond * 100
+
+	var addrB netip.AddrPort
+	for _, n := range []*Node{a, b} {
+		tr, err := ListenUDP("127.0.0.1:0")
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer tr.Close()
+		n.SetTransport(tr)
+		addrB = tr.Addr()
+		go n.Serve()
+	}
+	c := dht.Contact{
+		ID:    b.ID(),
+		Addrs: []netip.AddrPort{addrB},
+	}
+	a.AddContact(c, false)
+	assert.NoError(t, a.Ping(context.Background(), c))
+	ct, _ := a.Contact(c.ID)
+	assert.False(t, ct.LastSeen.IsZero())
+	assert.True(t, ct.RTT > 0)
+
+	// the wrong ID at the address does not count as alive
+	assert.False(t, a.Alive(dht.Contact{
+		ID:    dht.NodeID{201, 10, 15},
+		Addrs: []netip.AddrPort{addrB},
+	}))
+
+	b.Transport.Close()
+	assert.Equal(t, ErrNoPong, a.Ping(context.Background(), c))
+}
@@ -0,0 +1,144 @@
+package dhtnetwork
+
+import (
+	"context"
+	"github.com/dist-ribut-us/dht"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// DefaultRefreshInterval is the Interval a Refresher is created with.
+var DefaultRefreshInterval = time.Minute * 15
+
+// touched records when each bucket index was last touched by a lookup.
+type touched struct {
+	times []time.Time
+	sync.Mutex
+}
+
+func newTouched(links int) *touched {
+	return &touched{
+		times: make([]time.Time, links),
+	}
+}
+
+// bucketIndex returns the index of the first bit where id differs from the
+// Node's ID, which is the bucket it falls in, or -1 if they are the same.
+func (n *Node) bucketIndex(id dht.NodeID) int {
+	self := n.ID()
+	if len(id) != len(self) {
+		return -1
+	}
+	for i, b := range self.Xor(id) {
+		if b != 0 {
+			return i*8 + bits.LeadingZeros8(b)
+		}
+	}
+	return -1
+}
+
+// touch marks the bucket that id falls in as touched now.
+func (n *Node) touch(id dht.NodeID) {
+	idx := n.bucketIndex(id)
+	if idx < 0 {
+		return
+	}
+	n.touched.Lock()
+	n.touched.times[idx] = time.Now()
+	n.touched.Unlock()
+}
+
+// Touched returns when a lookup last got a response from a node in the bucket
+// index.
+func (n *Node) Touched(idx int) time.Time {
+	n.touched.Lock()
+	defer n.touched.Unlock()
+	if idx < 0 || idx >= len(n.touched.times) {
+		return time.Time{}
+	}
+	return n.touched.times[idx]
+}
+
+// Refresher refreshes the bucket indexes that no lookup has touched within
+// Interval. It walks the same indexes as Update.
+type Refresher struct {
+	Interval time.Duration
+	network  *Node
+}
+
+// Refresher creates a Refresher for the Node using DefaultRefreshInterval.
+func (n *Node) Refresher() *Refresher {
+	return &Refresher{
+		Interval: DefaultRefreshInterval,
+		network:  n,
+	}
+}
+
+// Stale returns the bucket indexes that have not been touched within Interval.
+func (r *Refresher) Stale() []int {
+	n := r.network
+	links := len(n.touched.times)
+	depth := n.updateDepth()
+	indexes := []int{0}
+	for idx := 1; idx <= depth && idx < links-1; idx++ {
+		indexes = append(indexes, idx)
+	}
+	if links > 1 {
+		indexes = append(indexes, links-1)
+	}
+
+	cutoff := time.Now().Add(-r.Interval)
+	var stale []int
+	n.touched.Lock()
+	for _, idx := range indexes {
+		if n.touched.times[idx].Before(cutoff) {
+			stale = append(stale, idx)
+		}
+	}
+	n.touched.Unlock()
+	return stale
+}
+
+// Updater returns an Updater for the stale bucket indexes or nil if there are
+// none. The indexes are marked as touched so they are not refreshed again
+// within Interval even if the Updater finds nothing.
+func (r *Refresher) Updater() *Updater {
+	stale := r.Stale()
+	if len(stale) == 0 {
+		return nil
+	}
+	now := time.Now()
+	r.network.touched.Lock()
+	for _, idx := range stale {
+		r.network.touched.times[idx] = now
+	}
+	r.network.touched.Unlock()
+	return r.network.UpdateIndexes(stale)
+}
+
+// Refresh runs an Updater over the stale bucket indexes using the Node's
+// Transport.
+func (r *Refresher) Refresh(ctx context.Context) error {
+	u := r.Updater()
+	if u == nil {
+		return nil
+	}
+	return r.network.Run(ctx, u)
+}
+
+// Run calls Refresh every Interval until ctx is done.
+func (r *Refresher) Run(ctx context.Context) error {
+	t := time.NewTicker(r.Interval)
+	defer t.Stop()
+	for {
+		if err := r.Refresh(ctx); err != nil {
+			return err
+		}
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
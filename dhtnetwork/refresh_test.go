@@ -0,0 +1,68 @@
+package dhtnetwork
+
+import (
+	"github.com/dist-ribut-us/dht"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestBucketIndex(t *testing.T) {
+	n := New([]byte{1, 10, 15}, 4, nil)
+	assert.Equal(t, 0, n.bucketIndex(dht.NodeID{129, 10, 15}))
+	assert.Equal(t, 7, n.bucketIndex(dht.NodeID{0, 10, 15}))
+	assert.Equal(t, 23, n.bucketIndex(dht.NodeID{1, 10, 14}))
+	assert.Equal(t, -1, n.bucketIndex(n.ID()))
+	assert.Equal(t, -1, n.bucketIndex(dht.NodeID{1}))
+}
+
+func TestLookupTouches(t *testing.T) {
+	n := New([]byte{1, 10, 15}, 4, nil)
+	id := dht.NodeID{129, 10, 15}
+	n.AddNodeID(id, false)
+	assert.True(t, n.Touched(0).IsZero())
+
+	s := n.Seek(dht.NodeID{128, 0, 0})
+	_, _, sr := s.Next()
+	s.Handle(SeekResponse{ID: sr.ID})
+	assert.False(t, n.Touched(0).IsZero())
+}
+
+func TestRefresherStale(t *testing.T) {
+	n := New([]byte{1, 10, 15}, 4, nil)
+	r := n.Refresher()
+	r.Interval = time.Minute
+
+	stale := r.Stale()
+	assert.Equal(t, 0, stale[0])
+	assert.Equal(t, 23, stale[len(stale)-1])
+	assert.Len(t, stale, defaultUpdateDepth+2)
+
+	n.touch(dht.NodeID{129, 10, 15})
+	n.touch(dht.NodeID{1, 10, 14})
+	stale = r.Stale()
+	assert.Len(t, stale, defaultUpdateDepth)
+	assert.NotContains(t, stale, 0)
+	assert.NotContains(t, stale, 23)
+
+	// the stale indexes are marked when an Updater is created
+	assert.NotNil(t, r.Updater())
+	assert.Len(t, r.Stale(), 0)
+	assert.Nil(t, r.Updater())
+}
+
+func TestUpdateIndexes(t *testing.T) {
+	n := New([]byte{1, 10, 15}, 4, nil)
+	near := dht.NodeID{1, 10, 14}
+	n.AddNodeID(dht.NodeID{129, 10, 15}, false)
+	n.AddNodeID(near, false)
+
+	u := n.UpdateIndexes([]int{23})
+	ok, id, sr := u.Next()
+	assert.True(t, ok)
+	assert.Equal(t, near, id)
+	assert.Equal(t, n.ID().FlipBit(23), sr.Target)
+	u.Handle(SeekResponse{ID: sr.ID})
+	ok, _, _ = u.Next()
+	assert.False(t, ok)
+}
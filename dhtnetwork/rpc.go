@@ -0,0 +1,224 @@
+package dhtnetwork
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"github.com/dist-ribut-us/dht"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout is the Timeout used by NewRPC when it is given 0.
+var DefaultTimeout = time.Second
+
+// ErrNoAddrs is returned when a request can't be sent because there is no
+// address known for the node.
+var ErrNoAddrs = errors.New("no address for node")
+
+// Lookup is a sequence of SeekRequests driven by the responses to the earlier
+// requests. Both Seeker and Updater are Lookups.
+type Lookup interface {
+	Next() (bool, dht.NodeID, SeekRequest)
+	Handle(SeekResponse) bool
+	HandleNoResponse(requestID []byte)
+}
+
+// SendFunc sends a SeekRequest to a node.
+type SendFunc func(id dht.NodeID, sr SeekRequest) error
+
+type call struct {
+	timer      *time.Timer
+	stop       func() bool
+	handle     func(interface{})
+	noResponse func()
+}
+
+// RPC matches responses to the requests that are waiting on them. If a response
+// does not arrive before Timeout the request's noResponse func is called.
+type RPC struct {
+	Timeout time.Duration
+	calls   map[string]*call
+	sync.Mutex
+}
+
+// NewRPC creates an RPC manager. If timeout is 0, DefaultTimeout is used.
+func NewRPC(timeout time.Duration) *RPC {
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	return &RPC{
+		Timeout: timeout,
+		calls:   make(map[string]*call),
+	}
+}
+
+// NewRequestID returns a random request ID.
+func NewRequestID() []byte {
+	id := make([]byte, DefaultIDLen)
+	rand.Read(id)
+	return id
+}
+
+// Request registers a request that is waiting on a response. Exactly one of
+// handle or noResponse will be called unless the request is canceled, either
+// by ctx or by calling Cancel.
+func (r *RPC) Request(ctx context.Context, requestID []byte, handle func(interface{}), noResponse func()) {
+	idStr := encodeToString(requestID)
+	c := &call{
+		handle:     handle,
+		noResponse: noResponse,
+	}
+	// the lock is held until c is fully set up because either func may fire
+	// immediately.
+	r.Lock()
+	r.calls[idStr] = c
+	c.timer = time.AfterFunc(r.Timeout, func() {
+		if c := r.take(idStr); c != nil && c.noResponse != nil {
+			c.noResponse()
+		}
+	})
+	if ctx != nil {
+		c.stop = context.AfterFunc(ctx, func() {
+			r.Cancel(requestID)
+		})
+	}
+	r.Unlock()
+}
+
+func (r *RPC) take(idStr string) *call {
+	r.Lock()
+	c, ok := r.calls[idStr]
+	if ok {
+		delete(r.calls, idStr)
+	}
+	r.Unlock()
+	if c == nil {
+		return nil
+	}
+	c.timer.Stop()
+	if c.stop != nil {
+		c.stop()
+	}
+	return c
+}
+
+// Respond passes the response to the request waiting on it. It returns false
+// if there was no request waiting, for instance if it had timed out.
+func (r *RPC) Respond(requestID []byte, resp interface{}) bool {
+	c := r.take(encodeToString(requestID))
+	if c == nil {
+		return false
+	}
+	if c.handle != nil {
+		c.handle(resp)
+	}
+	return true
+}
+
+// Cancel stops waiting on a request without calling either of it's funcs.
+func (r *RPC) Cancel(requestID []byte) {
+	r.take(encodeToString(requestID))
+}
+
+// Pending returns the number of requests waiting on a response.
+func (r *RPC) Pending() int {
+	r.Lock()
+	l := len(r.calls)
+	r.Unlock()
+	return l
+}
+
+type result struct {
+	requestID []byte
+	resp      interface{}
+	ok        bool
+}
+
+type doner interface {
+	Done() bool
+}
+
+// Run the Lookup until it has no more requests or ctx is done. Requests are
+// sent with send as long as Next returns them, so the Lookup is responsible for
+// limiting the requests in flight, as Seeker and Updater do with Alpha. The
+// Lookup is only called from the go routine running Run.
+func (r *RPC) Run(ctx context.Context, l Lookup, send SendFunc) error {
+	results := make(chan result)
+	stop := make(chan struct{})
+	defer close(stop)
+	deliver := func(res result) {
+		select {
+		case results <- res:
+		case <-stop:
+		}
+	}
+
+	pending := make(map[string][]byte)
+	defer func() {
+		for _, reqID := range pending {
+			r.Cancel(reqID)
+		}
+	}()
+
+	for {
+		for ok, id, sr := l.Next(); ok; ok, id, sr = l.Next() {
+			reqID := sr.ID
+			r.Request(ctx, reqID, func(resp interface{}) {
+				deliver(result{reqID, resp, true})
+			}, func() {
+				deliver(result{requestID: reqID})
+			})
+			idStr := encodeToString(reqID)
+			pending[idStr] = reqID
+			if err := send(id, sr); err != nil {
+				// if the call was already taken, either it timed out and the
+				// result is on it's way or ctx is done and Run will return, so
+				// it stays pending.
+				if r.take(idStr) != nil {
+					delete(pending, idStr)
+					l.HandleNoResponse(reqID)
+				}
+			}
+		}
+		if d, ok := l.(doner); len(pending) == 0 || (ok && d.Done()) {
+			return ctx.Err()
+		}
+
+		select {
+		case res := <-results:
+			delete(pending, encodeToString(res.requestID))
+			sr, isSeek := res.resp.(SeekResponse)
+			if res.ok && isSeek {
+				l.Handle(sr)
+			} else {
+				l.HandleNoResponse(res.requestID)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+type addresser interface {
+	Addrs(dht.NodeID) []netip.AddrPort
+}
+
+// Run the Lookup over the Node's Transport. If the Lookup has an Addrs method,
+// as Seeker and Updater do, it is used to find the address to send to,
+// otherwise the routing table is used.
+func (n *Node) Run(ctx context.Context, l Lookup) error {
+	return n.RPC.Run(ctx, l, func(id dht.NodeID, sr SeekRequest) error {
+		var addrs []netip.AddrPort
+		if a, ok := l.(addresser); ok {
+			addrs = a.Addrs(id)
+		} else if c, ok := n.Contact(id); ok {
+			addrs = c.Addrs
+		}
+		if len(addrs) == 0 {
+			return ErrNoAddrs
+		}
+		return n.Send(&sr, addrs[0])
+	})
+}
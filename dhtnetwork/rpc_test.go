@@ -0,0 +1,149 @@
+package dhtnetwork
+
+import (
+	"context"
+	"errors"
+	"github.com/dist-ribut-us/dht"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRPCRespond(t *testing.T) {
+	r := NewRPC(time.Second)
+	id := NewRequestID()
+	var got interface{}
+	r.Request(nil, id, func(resp interface{}) {
+		got = resp
+	}, func() {
+		t.Error("should not time out")
+	})
+	assert.Equal(t, 1, r.Pending())
+	assert.True(t, r.Respond(id, "response"))
+	assert.Equal(t, "response", got)
+	assert.Equal(t, 0, r.Pending())
+	assert.False(t, r.Respond(id, "response"))
+}
+
+func TestRPCTimeout(t *testing.T) {
+	r := NewRPC(time.Millisecond)
+	id := NewRequestID()
+	timedOut := make(chan bool)
+	r.Request(nil, id, func(resp interface{}) {
+		t.Error("should not be handled")
+	}, func() {
+		timedOut <- true
+	})
+	select {
+	case <-timedOut:
+	case <-time.After(time.Second):
+		t.Error("timeout was not called")
+	}
+	assert.False(t, r.Respond(id, "late"))
+}
+
+func TestRPCCancel(t *testing.T) {
+	r := NewRPC(time.Millisecond * 20)
+	ctx, cancel := context.WithCancel(context.Background())
+	r.Request(ctx, NewRequestID(), nil, func() {
+		t.Error("canceled request should not time out")
+	})
+	cancel()
+	time.Sleep(time.Millisecond * 40)
+	assert.Equal(t, 0, r.Pending())
+}
+
+func TestRPCRun(t *testing.T) {
+	n := New([]byte{1, 10, 15}, 4, nil)
+	remote := New([]byte{128, 10, 15}, 4, nil)
+	n.AddNodeID(remote.ID(), false)
+	target := dht.NodeID{129, 111, 222}
+	remote.AddNodeID(target, false)
+
+	r := NewRPC(time.Millisecond * 10)
+	sent := 0
+	err := r.Run(context.Background(), n.Seek(target), func(id dht.NodeID, sr SeekRequest) error {
+		sent++
+		if !id.Equal(remote.ID()) {
+			return errors.New("unreachable")
+		}
+		resp, _ := remote.HandleSeek(sr)
+		go r.Respond(sr.ID, resp)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, sent)
+	assert.Equal(t, 0, r.Pending())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = r.Run(ctx, n.Seek(dht.NodeID{64, 1, 1}), func(id dht.NodeID, sr SeekRequest) error {
+		return nil
+	})
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestRPCRunConcurrent(t *testing.T) {
+	n := New([]byte{1, 10, 15}, 4, nil)
+	for _, id := range []dht.NodeID{{128, 0, 0}, {129, 0, 0}, {130, 0, 0}, {131, 0, 0}} {
+		n.AddNodeID(id, false)
+	}
+	s := n.Seek(dht.NodeID{128, 0, 1})
+	s.SkipUpdate = true
+
+	r := NewRPC(time.Millisecond * 50)
+	var sent, mostInFlight int
+	err := r.Run(context.Background(), s, func(id dht.NodeID, sr SeekRequest) error {
+		sent++
+		if p := s.InFlight(); p > mostInFlight {
+			mostInFlight = p
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	// the first 3 requests are sent together, not one after another
+	assert.Equal(t, DefaultAlpha, mostInFlight)
+	assert.Equal(t, 4, sent)
+	// the local response when the Seeker is created and 4 timeouts
+	assert.Equal(t, 5, s.Responses)
+	assert.True(t, s.Done())
+}
+
+func TestRPCRunUpdaterAlpha(t *testing.T) {
+	n := New([]byte{1, 10, 15}, 4, nil)
+	for i := 0; i < 24; i++ {
+		n.AddNodeID(n.ID().FlipBit(i), false)
+	}
+	u := n.UpdateIndexes([]int{0, 2, 4, 6, 8, 10, 12})
+
+	r := NewRPC(time.Millisecond * 10)
+	var sent, mostInFlight int
+	err := r.Run(context.Background(), u, func(id dht.NodeID, sr SeekRequest) error {
+		sent++
+		if p := u.InFlight(); p > mostInFlight {
+			mostInFlight = p
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.True(t, sent >= 7)
+	assert.Equal(t, DefaultAlpha, mostInFlight)
+}
+
+func TestRPCRunSendFailsAfterTimeout(t *testing.T) {
+	n := New([]byte{1, 10, 15}, 4, nil)
+	n.AddNodeID(dht.NodeID{128, 0, 0}, false)
+	s := n.Seek(dht.NodeID{128, 0, 1})
+	s.SkipUpdate = true
+
+	r := NewRPC(time.Millisecond)
+	err := r.Run(context.Background(), s, func(id dht.NodeID, sr SeekRequest) error {
+		time.Sleep(time.Millisecond * 20)
+		return errors.New("unreachable")
+	})
+	assert.NoError(t, err)
+	// the local response and the request that timed out while it was sent
+	assert.Equal(t, 2, s.Responses)
+	assert.Equal(t, 0, s.InFlight())
+	assert.Equal(t, 0, r.Pending())
+}
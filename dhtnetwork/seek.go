@@ -15,9 +15,16 @@ type SeekRequest struct {
 	// Node that is seeking (so a response can be sent)
 	From         dht.NodeID
 	MustBeCloser bool
+	// Node the request is sent to and the Unix time it was signed at, so that a
+	// signed request can't be replayed to another node or at a later time.
+	To   dht.NodeID
+	Time int64
+	// Public and Sig are set by Sign, they are empty if the request is unsigned.
+	Public []byte
+	Sig    []byte
 }
 
-var seekRequestPrefixLengths = []int{2, -1, 2, 0}
+var seekRequestPrefixLengths = []int{2, -1, 2, 2, 2, -8, 1, 0}
 
 // Marshal serializes the SeekRequest
 func (s *SeekRequest) Marshal() ([]byte, error) {
@@ -30,6 +37,10 @@ func (s *SeekRequest) Marshal() ([]byte, error) {
 		mustBeCloser,
 		s.Target,
 		s.From,
+		s.To,
+		marshalTime(s.Time),
+		s.Public,
+		s.Sig,
 	}
 	return serial.MarshalByteSlices(seekRequestPrefixLengths, data)
 }
@@ -43,6 +54,10 @@ func (s *SeekRequest) Unmarshal(b []byte) error {
 	s.ID = data[0]
 	s.Target = data[2]
 	s.From = data[3]
+	s.To = orNil(data[4])
+	s.Time = unmarshalTime(data[5])
+	s.Public = orNil(data[6])
+	s.Sig = orNil(data[7])
 	if data[1][0] == 1 {
 		s.MustBeCloser = true
 	}
@@ -53,10 +68,15 @@ func (s *SeekRequest) Unmarshal(b []byte) error {
 // that are closer to the resource.
 type SeekResponse struct {
 	ID    []byte
-	Nodes []dht.NodeID
+	Nodes []dht.Contact
+	// From, Public and Sig are set by Sign, they are empty if the response is
+	// unsigned.
+	From   dht.NodeID
+	Public []byte
+	Sig    []byte
 }
 
-var seekResponsePrefixLengths = []int{1, 0}
+var seekResponsePrefixLengths = []int{1, 2, 1, 1, 0}
 var seekResponsePacker = serial.SlicesPacker{
 	Count: 2,
 	Size:  1,
@@ -64,16 +84,15 @@ var seekResponsePacker = serial.SlicesPacker{
 
 // Marshal serializes the SeekResponse
 func (s *SeekResponse) Marshal() ([]byte, error) {
-	data := make([][]byte, len(s.Nodes))
-	for i, id := range s.Nodes {
-		data[i] = id
-	}
-	nbs, err := seekResponsePacker.Marshal(data)
+	nbs, err := marshalContacts(s.Nodes)
 	if err != nil {
 		return nil, err
 	}
-	data = [][]byte{
+	data := [][]byte{
 		s.ID,
+		s.From,
+		s.Public,
+		s.Sig,
 		nbs,
 	}
 	return serial.MarshalByteSlices(seekResponsePrefixLengths, data)
@@ -86,29 +105,36 @@ func (s *SeekResponse) Unmarshal(b []byte) error {
 		return err
 	}
 	s.ID = data[0]
-	nbs, err := seekResponsePacker.Unmarshal(data[1])
-	if err != nil {
-		return err
-	}
-	s.Nodes = make([]dht.NodeID, len(nbs))
-	for i, id := range nbs {
-		s.Nodes[i] = id
-	}
-	return nil
+	s.From = orNil(data[1])
+	s.Public = orNil(data[2])
+	s.Sig = orNil(data[3])
+	s.Nodes, err = unmarshalContacts(data[4])
+	return err
 }
 
 // HandleSeek takes a SeekRequest and returns closer nodes up to length
 // ReturnNodes. It will not populate Data, instead it is expected that the layer
 // managing the hash data checks for the key and only cclosers this if the data is
-// not found.
-func (n *Node) HandleSeek(r SeekRequest) SeekResponse {
-	if !n.SkipRequestUpdate {
-		n.AddNodeID(r.From, true)
+// not found. If the request is not accepted by the signature policy there is
+// no response and the bool is false. The response is signed if the Node has an
+// Identity.
+func (n *Node) HandleSeek(r SeekRequest) (SeekResponse, bool) {
+	if !n.acceptsRequest(&r, r.ID, r.To, r.Time) {
+		return SeekResponse{}, false
 	}
+	n.learn(r.From)
+	resp := n.seekResponse(r)
+	n.sign(&resp)
+	return resp, true
+}
+
+// seekResponse returns the closer nodes for a SeekRequest without learning the
+// sender or signing the response.
+func (n *Node) seekResponse(r SeekRequest) SeekResponse {
 	// return n.bruteSeek(r)
 	return SeekResponse{
 		ID:    r.ID,
-		Nodes: n.SeekN(r.Target, n.ReturnNodes, r.MustBeCloser),
+		Nodes: n.SeekContacts(r.Target, n.ReturnNodes, r.MustBeCloser),
 	}
 }
 
@@ -116,8 +142,8 @@ func (n *Node) HandleSeek(r SeekRequest) SeekResponse {
 // nodes in the response falls into the range.
 func Search(target dht.NodeID) func(SeekResponse) bool {
 	return func(sr SeekResponse) bool {
-		for _, id := range sr.Nodes {
-			if id.Equal(target) {
+		for _, c := range sr.Nodes {
+			if c.ID.Equal(target) {
 				return true
 			}
 		}
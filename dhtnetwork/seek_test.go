@@ -1,13 +1,19 @@
 package dhtnetwork
 
 import (
+	"context"
 	"github.com/dist-ribut-us/dht"
 	"github.com/stretchr/testify/assert"
+	mr "math/rand"
+	"net/netip"
+	"sort"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestHandleSeek(t *testing.T) {
-	n := New([]byte{1, 10, 15}, 4)
+	n := New([]byte{1, 10, 15}, 4, nil)
 
 	ns := []dht.NodeID{
 		{128, 111, 222},
@@ -21,24 +27,25 @@ func TestHandleSeek(t *testing.T) {
 		ID:     []byte{1, 2, 3},
 		Target: dht.NodeID{128 + 64, 111, 222},
 	}
-	resp := n.HandleSeek(req)
-	assert.Equal(t, ns[0], resp.Nodes[0])
-	assert.Equal(t, ns[1], resp.Nodes[1])
+	resp, ok := n.HandleSeek(req)
+	assert.True(t, ok)
+	assert.Equal(t, ns[0], resp.Nodes[0].ID)
+	assert.Equal(t, ns[1], resp.Nodes[1].ID)
 
 	req = SeekRequest{
 		ID:     []byte{1, 2, 3},
 		Target: ns[0],
 	}
-	resp = n.HandleSeek(req)
-	assert.Equal(t, ns[0], resp.Nodes[0])
+	resp, _ = n.HandleSeek(req)
+	assert.Equal(t, ns[0], resp.Nodes[0].ID)
 
 	req = SeekRequest{
 		ID:           []byte{1, 2, 3},
 		Target:       ns[1],
 		MustBeCloser: true,
 	}
-	resp = n.HandleSeek(req)
-	assert.Equal(t, ns[1], resp.Nodes[0])
+	resp, _ = n.HandleSeek(req)
+	assert.Equal(t, ns[1], resp.Nodes[0].ID)
 }
 
 func TestSeekRequestRoundTrip(t *testing.T) {
@@ -59,10 +66,16 @@ func TestSeekRequestRoundTrip(t *testing.T) {
 func TestSeekResponseRoundTrip(t *testing.T) {
 	resp := SeekResponse{
 		ID: []byte{1, 2, 3},
-		Nodes: []dht.NodeID{
-			{64, 111, 222},
-			{128, 111, 222},
-			{64, 111, 222},
+		Nodes: []dht.Contact{
+			{ID: dht.NodeID{64, 111, 222}},
+			{
+				ID: dht.NodeID{128, 111, 222},
+				Addrs: []netip.AddrPort{
+					netip.MustParseAddrPort("10.0.0.1:5555"),
+					netip.MustParseAddrPort("[2001:db8::1]:6666"),
+				},
+			},
+			{ID: dht.NodeID{64, 111, 222}},
 		},
 	}
 
@@ -97,3 +110,166 @@ func TestInsert(t *testing.T) {
 
 	assert.Equal(t, -1, q[0].Xor(self).Compare(q[1].Xor(self)))
 }
+
+func TestSeekerUpdatesContacts(t *testing.T) {
+	a := New([]byte{1, 10, 15}, 4, nil)
+	b := New([]byte{128, 10, 15}, 4, nil)
+	c := dht.NodeID{64, 10, 15}
+	a.AddNodeID(b.ID(), false)
+	a.AddNodeID(c, false)
+
+	s := a.Seek(dht.NodeID{128 + 64, 10, 15})
+	ok, id, sr := s.Next()
+	assert.True(t, ok)
+	assert.Equal(t, b.ID(), id)
+	resp, ok := b.HandleSeek(sr)
+	assert.True(t, ok)
+	assert.True(t, s.Handle(resp))
+	contact, _ := a.Contact(b.ID())
+	assert.False(t, contact.LastSeen.IsZero())
+	assert.Equal(t, 0, contact.Failures)
+
+	ok, id, sr = s.Next()
+	assert.True(t, ok)
+	assert.Equal(t, c, id)
+	s.HandleNoResponse(sr.ID)
+	contact, _ = a.Contact(c)
+	assert.True(t, contact.LastSeen.IsZero())
+	assert.Equal(t, 1, contact.Failures)
+}
+
+func TestSeekerAddrs(t *testing.T) {
+	a := New([]byte{1, 10, 15}, 4, nil)
+	b := New([]byte{128, 10, 15}, 4, nil)
+	bAddr := netip.MustParseAddrPort("10.0.0.2:5555")
+	c := dht.Contact{
+		ID:    dht.NodeID{128 + 64, 10, 15},
+		Addrs: []netip.AddrPort{netip.MustParseAddrPort("10.0.0.3:5555")},
+	}
+	a.AddContact(dht.Contact{ID: b.ID(), Addrs: []netip.AddrPort{bAddr}}, false)
+	b.AddContact(c, false)
+
+	s := a.Seek(c.ID)
+	ok, id, sr := s.Next()
+	assert.True(t, ok)
+	assert.Equal(t, b.ID(), id)
+	assert.Equal(t, []netip.AddrPort{bAddr}, s.Addrs(id))
+	resp, _ := b.HandleSeek(sr)
+	s.Handle(resp)
+
+	ok, id, _ = s.Next()
+	assert.True(t, ok)
+	assert.Equal(t, c.ID, id)
+	assert.Equal(t, c.Addrs, s.Addrs(id))
+}
+
+func TestSeekerAlpha(t *testing.T) {
+	n := New([]byte{1, 10, 15}, 4, nil)
+	for _, id := range []dht.NodeID{{128, 0, 0}, {129, 0, 0}, {130, 0, 0}} {
+		n.AddNodeID(id, false)
+	}
+
+	s := n.Seek(dht.NodeID{128, 0, 1})
+	s.Alpha = 2
+	ok, _, sr1 := s.Next()
+	assert.True(t, ok)
+	ok, _, sr2 := s.Next()
+	assert.True(t, ok)
+	assert.Equal(t, 2, s.InFlight())
+	ok, _, _ = s.Next()
+	assert.False(t, ok)
+	assert.False(t, s.Done())
+
+	s.HandleNoResponse(sr1.ID)
+	assert.Equal(t, 1, s.InFlight())
+	ok, _, sr3 := s.Next()
+	assert.True(t, ok)
+
+	s.HandleNoResponse(sr2.ID)
+	assert.False(t, s.Done())
+	s.HandleNoResponse(sr3.ID)
+	assert.True(t, s.Done())
+}
+
+func TestFindClosest(t *testing.T) {
+	r := mr.New(mr.NewSource(31415))
+	nodes := make(map[string]*Node)
+	var ids []dht.NodeID
+	for i := 0; i < 50; i++ {
+		id := make([]byte, 4)
+		r.Read(id)
+		n := New(id, 4, nil)
+		nodes[n.ID().String()] = n
+		ids = append(ids, n.ID())
+	}
+	for _, n := range nodes {
+		for _, id := range ids {
+			n.AddNodeID(id, false)
+		}
+	}
+
+	target := dht.NodeID{1, 2, 3, 4}
+	k := 5
+	s := nodes[ids[0].String()].FindClosest(target, k)
+	rpc := NewRPC(time.Millisecond * 10)
+	err := rpc.Run(context.Background(), s, func(id dht.NodeID, sr SeekRequest) error {
+		resp, _ := nodes[id.String()].HandleSeek(sr)
+		go rpc.Respond(sr.ID, resp)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.True(t, s.Done())
+
+	// the seeking node is not part of the result
+	ids = ids[1:]
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].Xor(target).Compare(ids[j].Xor(target)) == -1
+	})
+	closest := s.Closest()
+	if assert.Len(t, closest, k) {
+		for i, c := range closest {
+			assert.Equal(t, ids[i], c.ID)
+		}
+	}
+}
+
+func TestSeekerConcurrent(t *testing.T) {
+	r := mr.New(mr.NewSource(2718))
+	n := New([]byte{1, 10, 15, 20}, 8, nil)
+	remote := New([]byte{200, 10, 15, 20}, 8, nil)
+	for i := 0; i < 200; i++ {
+		id := make([]byte, 4)
+		r.Read(id)
+		n.AddNodeID(id, false)
+		remote.AddNodeID(id, false)
+	}
+
+	s := n.Seek(dht.NodeID{128, 0, 0, 1})
+	s.Alpha = 8
+	s.StallRounds = 0
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50 && !s.Done(); i++ {
+				ok, id, sr := s.Next()
+				if !ok {
+					continue
+				}
+				s.Addrs(id)
+				if (g+i)%3 == 0 {
+					s.HandleNoResponse(sr.ID)
+				} else {
+					resp, _ := remote.HandleSeek(sr)
+					s.Handle(resp)
+				}
+				s.InFlight()
+				s.Reason()
+				s.Counts()
+			}
+		}(g)
+	}
+	wg.Wait()
+	assert.Equal(t, 0, s.InFlight())
+}
@@ -1,15 +1,23 @@
 package dhtnetwork
 
 import (
-	"crypto/rand"
 	"github.com/dist-ribut-us/dht"
+	"net/netip"
 	"sort"
+	"sync"
+	"time"
 )
 
 // DefaultIDLen is the lenght of SeekRequest IDs
 var DefaultIDLen = 10
 
-// Seeker manages Seeking a resource on the network
+// DefaultAlpha is the number of requests a Seeker allows in flight at once.
+var DefaultAlpha = 3
+
+// Seeker manages Seeking a resource on the network. It's methods are safe to
+// call from multiple go routines, but the exported fields should only be set
+// before the first request is sent and Accept must not call back into the
+// Seeker.
 type Seeker struct {
 	target     dht.NodeID
 	SkipUpdate bool
@@ -18,75 +26,321 @@ type Seeker struct {
 	sent       map[string]bool
 	Accept     func(SeekResponse) bool
 	done       bool
-	reqID2node map[string]dht.NodeID
-	Responses  int
-	Successes  int
+	reason     Termination
+	reqID2node map[string]request
+	addrs      addrBook
+	// Responses, Successes and Value are written as responses are handled, so
+	// they should only be read once Run has returned. Counts and Result can be
+	// used while requests are still in flight.
+	Responses int
+	Successes int
+	// Alpha is the most requests that can be waiting on a response at once.
+	Alpha int
+	// k is the number of closest nodes wanted by a Seeker created with
+	// FindClosest, it is 0 otherwise.
+	k         int
+	responded map[string]bool
+	failed    map[string]bool
+	// StallRounds is the number of rounds in a row, of Alpha responses each,
+	// that can fail to find a node closer than the best StallK before the
+	// Seeker gives up. It is DefaultStallRounds, if it is set to 0 the Seeker
+	// does not give up until there are no nodes left to query.
+	StallRounds int
+	// StallK is the number of closest nodes watched for progress. It is
+	// DefaultK, or k for a Seeker created with FindClosest.
+	StallK         int
+	stalls         int
+	roundResponses int
+	progress       bool
+	disjoint       *disjoint
+	// Value is set when a Seeker created with FindValue finds the value.
+	Value []byte
+	sync.RWMutex
+}
+
+// request tracks a SeekRequest that is waiting for a response.
+type request struct {
+	id   dht.NodeID
+	sent time.Time
+	path int
 }
 
 // Seek creates a Seeker for the given target.
 func (n *Node) Seek(target dht.NodeID) *Seeker {
 	s := &Seeker{
-		target:     target,
-		network:    n,
-		sent:       make(map[string]bool),
-		reqID2node: make(map[string]dht.NodeID),
+		target:      target,
+		network:     n,
+		sent:        make(map[string]bool),
+		reqID2node:  make(map[string]request),
+		addrs:       make(addrBook),
+		Alpha:       DefaultAlpha,
+		responded:   make(map[string]bool),
+		failed:      make(map[string]bool),
+		StallRounds: DefaultStallRounds,
+		StallK:      DefaultK,
+	}
+
+	if _, after := s.handle(n.seekResponse(s.seekRequest(n.ID(), false))); after != nil {
+		after()
+	}
+	// the local response is not part of a round
+	s.roundResponses, s.progress = 0, false
+	return s
+}
+
+// FindValue creates a Seeker for the value stored under key. Instead of
+// stopping when Accept returns true, it stops when a FindValueResponse returns
+// the value. Requests should be created with NextFindValue and responses passed
+// to HandleFindValue.
+func (n *Node) FindValue(key dht.NodeID) *Seeker {
+	s := n.Seek(key)
+	if v, ok := n.Value(key); ok {
+		s.Value = v
+		s.finish(FoundValue)
 	}
+	return s
+}
 
-	s.Handle(n.HandleSeek(s.seekRequest(n.ID(), false)))
+// FindClosest creates a Seeker that finds the k nodes closest to the target.
+// Accept is not used, instead the Seeker is done once the k closest nodes that
+// have not failed have all responded. They are returned by Closest.
+func (n *Node) FindClosest(target dht.NodeID, k int) *Seeker {
+	s := n.Seek(target)
+	s.k = k
+	s.StallK = k
+	s.checkClosest()
 	return s
 }
 
+// closest returns up to k of the closest queued nodes that have not failed.
+func (s *Seeker) closest() []dht.NodeID {
+	var ids []dht.NodeID
+	for _, id := range s.queue {
+		if len(ids) == s.k {
+			break
+		}
+		if !s.failed[id.String()] {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// checkClosest marks a FindClosest Seeker as done if the closest nodes have
+// all responded.
+func (s *Seeker) checkClosest() {
+	if s.k == 0 {
+		return
+	}
+	for _, id := range s.closest() {
+		if !s.responded[id.String()] {
+			return
+		}
+	}
+	s.finish(Converged)
+}
+
+// Closest returns the contacts for the k closest nodes that responded, ordered
+// by distance to the target. It is only meaningful for a Seeker created with
+// FindClosest and is complete once the Seeker is done.
+func (s *Seeker) Closest() []dht.Contact {
+	s.RLock()
+	defer s.RUnlock()
+	var cs []dht.Contact
+	for _, id := range s.queue {
+		if len(cs) == s.k {
+			break
+		}
+		if s.responded[id.String()] {
+			cs = append(cs, dht.Contact{
+				ID:    id,
+				Addrs: s.addrs.lookup(s.network, id),
+			})
+		}
+	}
+	return cs
+}
+
 // Handle a SeekResponse and add the nodes in the response to the queue
 func (s *Seeker) Handle(r SeekResponse) bool {
-	if s.done == true {
+	s.Lock()
+	if !s.accepts(r.ID, &r, r.From) {
+		s.Unlock()
 		return false
 	}
+	ok, after := s.handle(r)
+	s.Unlock()
+	if after != nil {
+		after()
+	}
+	return ok
+}
+
+// accepts applies the Node's signature policy to the response for a request
+// the Seeker is waiting on. It should be called with the lock held.
+func (s *Seeker) accepts(requestID []byte, r signed, signer dht.NodeID) bool {
+	if s.network == nil {
+		return true
+	}
+	req, found := s.reqID2node[encodeToString(requestID)]
+	return !found || s.network.acceptsResponse(r, signer, req.id)
+}
+
+// handle a SeekResponse. The func returned updates the routing table for the
+// node that responded, it should be called once the lock is released.
+func (s *Seeker) handle(r SeekResponse) (bool, func()) {
+	if s.done == true {
+		return false, nil
+	}
 	rIDstr := encodeToString(r.ID)
-	nID, found := s.reqID2node[rIDstr]
+	req, found := s.reqID2node[rIDstr]
 	if !found {
-		return false
+		return false, nil
 	}
 	delete(s.reqID2node, rIDstr)
-	if s.network != nil && !s.SkipUpdate {
-		s.network.AddNodeID(nID, true)
+	var after func()
+	if n := s.network; n != nil {
+		skip := s.SkipUpdate
+		c := dht.Contact{
+			ID:       req.id,
+			Addrs:    s.addrs[req.id.String()],
+			LastSeen: time.Now(),
+			RTT:      time.Since(req.sent),
+		}
+		after = func() {
+			n.touch(c.ID)
+			if !skip {
+				n.AddContact(c, true)
+			}
+		}
 	}
 
-	for _, id := range r.Nodes {
-		s.queue = insert(s.queue, s.target, id)
+	var self dht.NodeID
+	if s.network != nil {
+		self = s.network.ID()
+	}
+	s.addrs.learn(r.Nodes)
+	worst := s.worstBest()
+	progress := false
+	for _, c := range r.Nodes {
+		if self.Equal(c.ID) {
+			continue
+		}
+		l := len(s.queue)
+		s.queue = insert(s.queue, s.target, c.ID)
+		if s.disjoint != nil {
+			s.disjoint.add(req.path, s.target, c.ID)
+		}
+		if len(s.queue) > l && (worst == nil || c.ID.Xor(s.target).Compare(worst.Xor(s.target)) == -1) {
+			progress = true
+		}
 	}
 
-	if s.Accept != nil && s.Accept(r) {
-		s.done = true
+	s.responded[req.id.String()] = true
+	if s.k > 0 {
+		s.checkClosest()
+	} else if s.Accept != nil && s.Accept(r) {
+		s.finish(Accepted)
+		if s.disjoint != nil {
+			s.disjoint.success = req.path
+		}
 	}
 	s.Responses++
 	s.Successes++
-	return true
+	s.endRound(progress)
+	return true, after
+}
+
+// Counts returns the number of responses handled, including requests that got
+// no response, and the number of those that were successful.
+func (s *Seeker) Counts() (responses, successes int) {
+	s.RLock()
+	defer s.RUnlock()
+	return s.Responses, s.Successes
+}
+
+// Result returns the value found by a Seeker created with FindValue or nil if it
+// has not been found.
+func (s *Seeker) Result() []byte {
+	s.RLock()
+	defer s.RUnlock()
+	return s.Value
+}
+
+// Addrs returns the addresses for a NodeID returned by Next. They are taken
+// from the responses the Seeker has handled or from the routing table.
+func (s *Seeker) Addrs(id dht.NodeID) []netip.AddrPort {
+	s.RLock()
+	defer s.RUnlock()
+	return s.addrs.lookup(s.network, id)
+}
+
+// HandleFindValue handles a FindValueResponse. If the response holds the value,
+// it is set on the Seeker and the search is done, otherwise the nodes in the
+// response are added to the queue.
+func (s *Seeker) HandleFindValue(r FindValueResponse) bool {
+	s.Lock()
+	if !s.accepts(r.ID, &r, r.From) {
+		s.Unlock()
+		return false
+	}
+	ok, after := s.handle(SeekResponse{ID: r.ID, Nodes: r.Nodes})
+	if ok && r.Value != nil {
+		s.Value = r.Value
+		s.finish(FoundValue)
+	}
+	s.Unlock()
+	if after != nil {
+		after()
+	}
+	return ok
 }
 
 // HandleNoResponse handles the case that a request never got a response.
 func (s *Seeker) HandleNoResponse(requestID []byte) {
+	s.Lock()
 	if s.done == true {
+		s.Unlock()
 		return
 	}
-	_, found := s.reqID2node[encodeToString(requestID)]
+	rIDstr := encodeToString(requestID)
+	req, found := s.reqID2node[rIDstr]
 	if !found {
+		s.Unlock()
 		return
 	}
+	delete(s.reqID2node, rIDstr)
+	s.failed[req.id.String()] = true
+	s.checkClosest()
 	s.Responses++
+	s.endRound(false)
+	n, skip := s.network, s.SkipUpdate
+	s.Unlock()
+	if n != nil && !skip {
+		n.Failed(req.id)
+	}
 }
 
 func (s *Seeker) seekRequest(id dht.NodeID, mustBeCloser bool) SeekRequest {
 	sr := SeekRequest{
 		Target:       s.target,
-		ID:           make([]byte, DefaultIDLen),
+		ID:           NewRequestID(),
 		MustBeCloser: mustBeCloser,
 	}
-	rand.Read(sr.ID)
 	if s.network != nil {
 		sr.From = s.network.ID()
+		sr.To = id
 	}
 	s.sent[id.String()] = true
-	s.reqID2node[encodeToString(sr.ID)] = id
+	req := request{
+		id:   id,
+		sent: time.Now(),
+	}
+	if s.disjoint != nil {
+		req.path = s.disjoint.owner[id.String()]
+		s.disjoint.next = (req.path + 1) % len(s.disjoint.paths)
+	}
+	s.reqID2node[encodeToString(sr.ID)] = req
 	return sr
 }
 
@@ -94,22 +348,97 @@ var maxQueueDepth = 20
 
 // Next returns a bool indication if there this is a valid request, the NodeID
 // the request should be sent to and a SeekRequest. It is meant to be used in a
-// loop
+// loop. Next returns false while Alpha requests are in flight, so when
+// requests are sent concurrently, Done should be checked before giving up.
 func (s *Seeker) Next() (bool, dht.NodeID, SeekRequest) {
-	if s.done {
+	ok, id, sr := s.next()
+	if ok && s.network != nil {
+		s.network.sign(&sr)
+	}
+	return ok, id, sr
+}
+
+// next is Next without signing the request, so NextFindValue only signs the
+// request it returns.
+func (s *Seeker) next() (bool, dht.NodeID, SeekRequest) {
+	s.Lock()
+	defer s.Unlock()
+	if s.done || len(s.reqID2node) >= s.alpha() {
+		return false, nil, SeekRequest{}
+	}
+	id := s.nextID()
+	if id == nil {
 		return false, nil, SeekRequest{}
 	}
-	var id dht.NodeID
+	return true, id, s.seekRequest(id, s.k == 0)
+}
+
+// nextID returns the closest queued NodeID that has not been sent a request.
+// A FindClosest Seeker only considers it's k closest nodes and a SeekDisjoint
+// Seeker takes it's paths in turn.
+func (s *Seeker) nextID() dht.NodeID {
+	if s.disjoint != nil {
+		return s.disjoint.nextID(s.sent)
+	}
+	if s.k > 0 {
+		for _, id := range s.closest() {
+			if !s.sent[id.String()] {
+				return id
+			}
+		}
+		return nil
+	}
 	for i := 0; i < maxQueueDepth && i < len(s.queue); i++ {
-		if idi := s.queue[i]; !s.sent[idi.String()] {
-			id = idi
-			break
+		if id := s.queue[i]; !s.sent[id.String()] {
+			return id
 		}
 	}
-	if id == nil {
-		return false, nil, SeekRequest{}
+	return nil
+}
+
+func (s *Seeker) alpha() int {
+	if s.Alpha < 1 {
+		return 1
+	}
+	return s.Alpha
+}
+
+// InFlight returns the number of requests waiting on a response.
+func (s *Seeker) InFlight() int {
+	s.RLock()
+	defer s.RUnlock()
+	return len(s.reqID2node)
+}
+
+// Done returns true if the Seeker will not produce any more requests, either
+// because it has finished or because there are no requests in flight and no
+// nodes left to query.
+func (s *Seeker) Done() bool {
+	s.RLock()
+	defer s.RUnlock()
+	return s.isDone()
+}
+
+func (s *Seeker) isDone() bool {
+	return s.done || (len(s.reqID2node) == 0 && s.nextID() == nil)
+}
+
+// NextFindValue is the same as Next, but returns a FindValueRequest.
+func (s *Seeker) NextFindValue() (bool, dht.NodeID, FindValueRequest) {
+	ok, id, sr := s.next()
+	if !ok {
+		return false, nil, FindValueRequest{}
+	}
+	fr := FindValueRequest{
+		ID:   sr.ID,
+		Key:  sr.Target,
+		From: sr.From,
+		To:   id,
+	}
+	if s.network != nil {
+		s.network.sign(&fr)
 	}
-	return true, id, s.seekRequest(id, true)
+	return true, id, fr
 }
 
 func insert(q []dht.NodeID, self, id dht.NodeID) []dht.NodeID {
@@ -0,0 +1,117 @@
+package dhtnetwork
+
+import (
+	"errors"
+	"github.com/dist-ribut-us/dht"
+	"net/netip"
+	"time"
+)
+
+// ErrNoTransport is returned when sending from a Node without a Transport.
+var ErrNoTransport = errors.New("node has no transport")
+
+// Send the message to the address using the Node's Transport.
+func (n *Node) Send(msg Message, to netip.AddrPort) error {
+	if n.Transport == nil {
+		return ErrNoTransport
+	}
+	b, err := Encode(msg, 0)
+	if err != nil {
+		return err
+	}
+	return n.Transport.Send(b, to)
+}
+
+// SetTransport sets the Transport used by Send and Serve. Contacts chosen for
+// eviction are then verified with Alive, which needs the Transport to ping
+// them.
+func (n *Node) SetTransport(t Transport) {
+	n.Transport = t
+	n.Verify = nil
+	if t != nil {
+		n.Verify = n.Alive
+	}
+}
+
+// Serve reads packets from the Node's Transport until it returns an error.
+// Requests are answered and responses are passed to the Node's RPC. An error
+// sending a response is passed to OnSendError, if it is set.
+func (n *Node) Serve() error {
+	if n.Transport == nil {
+		return ErrNoTransport
+	}
+	for {
+		b, from, err := n.Transport.Receive()
+		if err != nil {
+			return err
+		}
+		if err := n.handlePacket(b, from); err != nil && n.OnSendError != nil {
+			n.OnSendError(err, from)
+		}
+	}
+}
+
+// learnFrom adds the node that sent a request and the address it was sent from
+// to the routing table.
+func (n *Node) learnFrom(id dht.NodeID, from netip.AddrPort) {
+	if n.SkipRequestUpdate || len(id) != n.IDlen {
+		return
+	}
+	n.AddContact(dht.Contact{
+		ID:       id,
+		Addrs:    []netip.AddrPort{from},
+		LastSeen: time.Now(),
+	}, true)
+}
+
+// handlePacket answers a request or passes a response to the RPC. It returns
+// the error from sending a response, packets that can't be decoded are dropped.
+func (n *Node) handlePacket(b []byte, from netip.AddrPort) error {
+	msg, _, err := Decode(b)
+	if err != nil {
+		return nil
+	}
+	switch m := msg.(type) {
+	case *SeekRequest:
+		if !n.acceptsRequest(m, m.ID, m.To, m.Time) {
+			return nil
+		}
+		n.learnFrom(m.From, from)
+		resp := n.seekResponse(*m)
+		n.sign(&resp)
+		return n.Send(&resp, from)
+	case *StoreRequest:
+		if !n.acceptsRequest(m, m.ID, m.To, m.Time) {
+			return nil
+		}
+		n.learnFrom(m.From, from)
+		resp := n.store(*m)
+		return n.Send(&resp, from)
+	case *FindValueRequest:
+		if !n.acceptsRequest(m, m.ID, m.To, m.Time) {
+			return nil
+		}
+		n.learnFrom(m.From, from)
+		resp := n.findValueResponse(*m)
+		n.sign(&resp)
+		return n.Send(&resp, from)
+	case *Ping:
+		if !n.acceptsRequest(m, m.ID, m.To, m.Time) {
+			return nil
+		}
+		n.learnFrom(m.From, from)
+		resp := n.pong(*m)
+		return n.Send(&resp, from)
+	case *Leave:
+		n.HandleLeave(*m, from)
+	case *SeekResponse:
+		n.RPC.Respond(m.ID, *m)
+	case *StoreResponse:
+		n.RPC.Respond(m.ID, *m)
+	case *FindValueResponse:
+		n.RPC.Respond(m.ID, *m)
+	case *Pong:
+		n.RPC.Respond(m.ID, *m)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package dhtnetwork
+
+import (
+	"context"
+	"errors"
+	"github.com/dist-ribut-us/dht"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestServeUDP(t *testing.T) {
+	a := New([]byte{1, 10, 15}, 4, nil)
+	b := New([]byte{200, 10, 15}, 4, nil)
+	c := New([]byte{129, 111, 222}, 4, nil)
+
+	addrs := make(map[*Node]netip.AddrPort)
+	for _, n := range []*Node{a, b, c} {
+		tr, err := ListenUDP("127.0.0.1:0")
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer tr.Close()
+		n.SetTransport(tr)
+		addrs[n] = tr.Addr()
+		go n.Serve()
+	}
+	a.AddContact(dht.Contact{
+		ID:    b.ID(),
+		Addrs: []netip.AddrPort{addrs[b]},
+	}, false)
+	b.AddContact(dht.Contact{
+		ID:    c.ID(),
+		Addrs: []netip.AddrPort{addrs[c]},
+	}, false)
+
+	s := a.Seek(c.ID())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, a.Run(ctx, s))
+	assert.Equal(t, 3, s.Successes)
+
+	// a learned c's address from b and each learned a's address from the
+	// request
+	ct, ok := a.Contact(c.ID())
+	if assert.True(t, ok) {
+		assert.Equal(t, addrs[c], ct.Addrs[0])
+	}
+	for _, n := range []*Node{b, c} {
+		ct, ok := n.Contact(a.ID())
+		if assert.True(t, ok) {
+			assert.Equal(t, addrs[a], ct.Addrs[0])
+		}
+	}
+}
+
+func TestSendNoTransport(t *testing.T) {
+	n := New([]byte{1, 10, 15}, 4, nil)
+	assert.Equal(t, ErrNoTransport, n.Send(&SeekRequest{}, netip.AddrPort{}))
+}
+
+func TestSetTransport(t *testing.T) {
+	n := New([]byte{1, 10, 15}, 4, nil)
+	assert.Nil(t, n.Verify)
+
+	tr, err := ListenUDP("127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer tr.Close()
+	n.SetTransport(tr)
+	assert.NotNil(t, n.Verify)
+
+	n.SetTransport(nil)
+	assert.Nil(t, n.Verify)
+}
+
+// failingTransport delivers it's packets to Serve and fails every Send.
+type failingTransport struct {
+	packets [][]byte
+	from    netip.AddrPort
+}
+
+func (f *failingTransport) Send(b []byte, to netip.AddrPort) error {
+	return errors.New("message too long")
+}
+
+func (f *failingTransport) Receive() ([]byte, netip.AddrPort, error) {
+	if len(f.packets) == 0 {
+		return nil, f.from, io.EOF
+	}
+	b := f.packets[0]
+	f.packets = f.packets[1:]
+	return b, f.from, nil
+}
+
+func (f *failingTransport) Close() error { return nil }
+
+func TestServeSendError(t *testing.T) {
+	n := New([]byte{1, 10, 15}, 4, nil)
+	ping, err := Encode(&Ping{ID: []byte{1}, From: dht.NodeID{200, 10, 15}}, 0)
+	assert.NoError(t, err)
+	tr := &failingTransport{
+		packets: [][]byte{ping},
+		from:    netip.MustParseAddrPort("10.0.0.1:5555"),
+	}
+	n.SetTransport(tr)
+	var errs []error
+	var tos []netip.AddrPort
+	n.OnSendError = func(err error, to netip.AddrPort) {
+		errs = append(errs, err)
+		tos = append(tos, to)
+	}
+	assert.Equal(t, io.EOF, n.Serve())
+	if assert.Len(t, errs, 1) {
+		assert.EqualError(t, errs[0], "message too long")
+		assert.Equal(t, tr.from, tos[0])
+	}
+}
@@ -0,0 +1,283 @@
+package dhtnetwork
+
+import (
+	"encoding/binary"
+	"github.com/dist-ribut-us/dht"
+	"sync"
+	"time"
+)
+
+// SignatureWindow is how far the Time of a signed request can be from the local
+// clock. Signed request IDs are remembered for twice as long so they can't be
+// replayed.
+var SignatureWindow = 30 * time.Second
+
+// signed is a message that can carry a signature from it's sender.
+type signed interface {
+	Signed() bool
+	Verify() bool
+}
+
+// Sign the SeekRequest with the Identity. From is set to the Identity's ID and
+// Time to now. To should be set before signing.
+func (s *SeekRequest) Sign(id *dht.Identity) error {
+	s.Time = time.Now().Unix()
+	return sign(id, &s.From, &s.Public, &s.Sig, s.Marshal)
+}
+
+// Signed returns true if the SeekRequest carries a signature.
+func (s *SeekRequest) Signed() bool {
+	return len(s.Sig) > 0
+}
+
+// Verify returns true if the SeekRequest is signed by the key that From is
+// derived from.
+func (s *SeekRequest) Verify() bool {
+	cp := *s
+	cp.Sig = nil
+	return verify(s.From, s.Public, s.Sig, cp.Marshal)
+}
+
+// Sign the SeekResponse with the Identity. From is set to the Identity's ID.
+func (s *SeekResponse) Sign(id *dht.Identity) error {
+	return sign(id, &s.From, &s.Public, &s.Sig, s.Marshal)
+}
+
+// Signed returns true if the SeekResponse carries a signature.
+func (s *SeekResponse) Signed() bool {
+	return len(s.Sig) > 0
+}
+
+// Verify returns true if the SeekResponse is signed by the key that From is
+// derived from.
+func (s *SeekResponse) Verify() bool {
+	cp := *s
+	cp.Sig = nil
+	return verify(s.From, s.Public, s.Sig, cp.Marshal)
+}
+
+// Sign the FindValueResponse with the Identity. From is set to the Identity's
+// ID.
+func (f *FindValueResponse) Sign(id *dht.Identity) error {
+	return sign(id, &f.From, &f.Public, &f.Sig, f.Marshal)
+}
+
+// Signed returns true if the FindValueResponse carries a signature.
+func (f *FindValueResponse) Signed() bool {
+	return len(f.Sig) > 0
+}
+
+// Verify returns true if the FindValueResponse is signed by the key that From
+// is derived from.
+func (f *FindValueResponse) Verify() bool {
+	cp := *f
+	cp.Sig = nil
+	return verify(f.From, f.Public, f.Sig, cp.Marshal)
+}
+
+// Sign the StoreRequest with the Identity. From is set to the Identity's ID and
+// Time to now. To should be set before signing.
+func (s *StoreRequest) Sign(id *dht.Identity) error {
+	s.Time = time.Now().Unix()
+	return sign(id, &s.From, &s.Public, &s.Sig, s.Marshal)
+}
+
+// Signed returns true if the StoreRequest carries a signature.
+func (s *StoreRequest) Signed() bool {
+	return len(s.Sig) > 0
+}
+
+// Verify returns true if the StoreRequest is signed by the key that From is
+// derived from.
+func (s *StoreRequest) Verify() bool {
+	cp := *s
+	cp.Sig = nil
+	return verify(s.From, s.Public, s.Sig, cp.Marshal)
+}
+
+// Sign the FindValueRequest with the Identity. From is set to the Identity's ID
+// and Time to now. To should be set before signing.
+func (f *FindValueRequest) Sign(id *dht.Identity) error {
+	f.Time = time.Now().Unix()
+	return sign(id, &f.From, &f.Public, &f.Sig, f.Marshal)
+}
+
+// Signed returns true if the FindValueRequest carries a signature.
+func (f *FindValueRequest) Signed() bool {
+	return len(f.Sig) > 0
+}
+
+// Verify returns true if the FindValueRequest is signed by the key that From is
+// derived from.
+func (f *FindValueRequest) Verify() bool {
+	cp := *f
+	cp.Sig = nil
+	return verify(f.From, f.Public, f.Sig, cp.Marshal)
+}
+
+// Sign the Ping with the Identity. From is set to the Identity's ID and Time to
+// now. To should be set before signing.
+func (p *Ping) Sign(id *dht.Identity) error {
+	p.Time = time.Now().Unix()
+	return sign(id, &p.From, &p.Public, &p.Sig, p.Marshal)
+}
+
+// Signed returns true if the Ping carries a signature.
+func (p *Ping) Signed() bool {
+	return len(p.Sig) > 0
+}
+
+// Verify returns true if the Ping is signed by the key that From is derived
+// from.
+func (p *Ping) Verify() bool {
+	cp := *p
+	cp.Sig = nil
+	return verify(p.From, p.Public, p.Sig, cp.Marshal)
+}
+
+// Sign the Leave with the Identity. From is set to the Identity's ID and Time
+// to now. To should be set before signing.
+func (l *Leave) Sign(id *dht.Identity) error {
+	l.Time = time.Now().Unix()
+	return sign(id, &l.From, &l.Public, &l.Sig, l.Marshal)
+}
+
+// Signed returns true if the Leave carries a signature.
+func (l *Leave) Signed() bool {
+	return len(l.Sig) > 0
+}
+
+// Verify returns true if the Leave is signed by the key that From is derived
+// from.
+func (l *Leave) Verify() bool {
+	cp := *l
+	cp.Sig = nil
+	return verify(l.From, l.Public, l.Sig, cp.Marshal)
+}
+
+// sign sets the from, public and sig fields of a message. The signature covers
+// the message as marshalled with sig empty.
+func sign(id *dht.Identity, from *dht.NodeID, public, sig *[]byte, marshal func() ([]byte, error)) error {
+	*from = id.ID
+	*public = id.Public
+	*sig = nil
+	b, err := marshal()
+	if err != nil {
+		return err
+	}
+	*sig = id.Sign(b)
+	return nil
+}
+
+// verify checks that from is derived from public and that sig is public's
+// signature of the message marshalled with sig empty.
+func verify(from dht.NodeID, public, sig []byte, unsigned func() ([]byte, error)) bool {
+	if len(sig) == 0 || !dht.VerifyID(from, public) {
+		return false
+	}
+	b, err := unsigned()
+	return err == nil && dht.Verify(public, b, sig)
+}
+
+// accepts applies the signature policy to a message. A badly signed message is
+// never accepted and an unsigned message is only accepted if the Node does not
+// RequireSignatures.
+func (n *Node) accepts(m signed) bool {
+	if !m.Signed() {
+		return !n.RequireSignatures
+	}
+	return m.Verify()
+}
+
+// acceptsRequest applies the signature policy to a request. A signed request
+// must also be addressed to this Node, signed within SignatureWindow and it's
+// ID must not have been seen before.
+func (n *Node) acceptsRequest(r signed, requestID []byte, to dht.NodeID, t int64) bool {
+	if !r.Signed() {
+		return !n.RequireSignatures
+	}
+	return n.fresh(to, t) && r.Verify() && n.replays.first(requestID)
+}
+
+// fresh returns true if a signed request is addressed to this Node and was
+// signed within SignatureWindow.
+func (n *Node) fresh(to dht.NodeID, t int64) bool {
+	if !to.Equal(n.ID()) {
+		return false
+	}
+	age := time.Since(time.Unix(t, 0))
+	return age < SignatureWindow && age > -SignatureWindow
+}
+
+// acceptsResponse applies the signature policy to a response signed by signer
+// that should have come from the node with the ID from.
+func (n *Node) acceptsResponse(r signed, signer, from dht.NodeID) bool {
+	if r.Signed() && !signer.Equal(from) {
+		return false
+	}
+	return n.accepts(r)
+}
+
+// sign a message if the Node has an Identity. If signing fails the message is
+// left unsigned, nodes that RequireSignatures will drop it.
+func (n *Node) sign(m interface{ Sign(*dht.Identity) error }) {
+	if n.Identity != nil {
+		m.Sign(n.Identity)
+	}
+}
+
+// orNil returns nil for an empty field so an unsigned message unmarshals to
+// it's zero signature fields.
+func orNil(b []byte) []byte {
+	if len(b) == 0 {
+		return nil
+	}
+	return b
+}
+
+// marshalTime encodes a Unix time as 8 bytes.
+func marshalTime(t int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(t))
+	return b
+}
+
+func unmarshalTime(b []byte) int64 {
+	return int64(binary.BigEndian.Uint64(b))
+}
+
+// replays remembers the IDs of signed requests that have been accepted.
+type replays struct {
+	seen   map[string]time.Time
+	pruned time.Time
+	sync.Mutex
+}
+
+func newReplays() *replays {
+	return &replays{
+		seen:   make(map[string]time.Time),
+		pruned: time.Now(),
+	}
+}
+
+// first records the request ID and returns true if it has not been seen within
+// twice SignatureWindow.
+func (r *replays) first(requestID []byte) bool {
+	now := time.Now()
+	idStr := encodeToString(requestID)
+	r.Lock()
+	defer r.Unlock()
+	if now.Sub(r.pruned) > SignatureWindow {
+		for k, t := range r.seen {
+			if now.Sub(t) > 2*SignatureWindow {
+				delete(r.seen, k)
+			}
+		}
+		r.pruned = now
+	}
+	if _, ok := r.seen[idStr]; ok {
+		return false
+	}
+	r.seen[idStr] = now
+	return true
+}
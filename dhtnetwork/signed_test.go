@@ -0,0 +1,257 @@
+package dhtnetwork
+
+import (
+	"github.com/dist-ribut-us/dht"
+	"github.com/stretchr/testify/assert"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func newSignedNode(t *testing.T) *Node {
+	id, err := dht.GenerateIdentity()
+	assert.NoError(t, err)
+	n := New(id.ID, 4, nil)
+	n.Identity = id
+	return n
+}
+
+func TestSignSeekRequest(t *testing.T) {
+	id, err := dht.GenerateIdentity()
+	assert.NoError(t, err)
+
+	req := SeekRequest{
+		ID:     []byte{1, 2, 3},
+		Target: dht.NodeID{64, 111, 222},
+	}
+	assert.False(t, req.Signed())
+	assert.False(t, req.Verify())
+	assert.NoError(t, req.Sign(id))
+	assert.True(t, req.Verify())
+	assert.Equal(t, id.ID, req.From)
+
+	b, err := req.Marshal()
+	assert.NoError(t, err)
+	var out SeekRequest
+	assert.NoError(t, out.Unmarshal(b))
+	assert.True(t, out.Verify())
+
+	out.Target = dht.NodeID{65, 111, 222}
+	assert.False(t, out.Verify())
+
+	other, err := dht.GenerateIdentity()
+	assert.NoError(t, err)
+	req.From = other.ID
+	assert.False(t, req.Verify())
+}
+
+func TestSignSeekResponse(t *testing.T) {
+	id, err := dht.GenerateIdentity()
+	assert.NoError(t, err)
+
+	resp := SeekResponse{
+		ID:    []byte{1, 2, 3},
+		Nodes: []dht.Contact{{ID: dht.NodeID{64, 111, 222}}},
+	}
+	assert.NoError(t, resp.Sign(id))
+
+	b, err := resp.Marshal()
+	assert.NoError(t, err)
+	var out SeekResponse
+	assert.NoError(t, out.Unmarshal(b))
+	assert.True(t, out.Verify())
+
+	out.Nodes[0].ID = dht.NodeID{65, 111, 222}
+	assert.False(t, out.Verify())
+}
+
+func TestHandleSeekSignatures(t *testing.T) {
+	a := newSignedNode(t)
+	b := newSignedNode(t)
+	spoofed := newSignedNode(t).ID()
+
+	req := SeekRequest{
+		ID:     []byte{1, 2, 3},
+		Target: a.ID(),
+		From:   spoofed,
+	}
+	a.RequireSignatures = true
+	_, ok := a.HandleSeek(req)
+	assert.False(t, ok)
+	assert.Equal(t, 0, a.KnownIDs())
+
+	req.To = a.ID()
+	b.sign(&req)
+	req.From = spoofed
+	a.RequireSignatures = false
+	_, ok = a.HandleSeek(req)
+	assert.False(t, ok)
+	assert.Equal(t, 0, a.KnownIDs())
+
+	req.From = b.ID()
+	a.RequireSignatures = true
+	resp, ok := a.HandleSeek(req)
+	assert.True(t, ok)
+	assert.Equal(t, b.ID(), a.Node.Seek(b.ID(), false))
+	assert.True(t, resp.Verify())
+	assert.Equal(t, a.ID(), resp.From)
+}
+
+func TestHandleSeekReplay(t *testing.T) {
+	a := newSignedNode(t)
+	b := newSignedNode(t)
+	c := newSignedNode(t)
+	a.RequireSignatures = true
+
+	// addressed to another node
+	req := SeekRequest{
+		ID:     []byte{1, 2, 3},
+		Target: a.ID(),
+		To:     c.ID(),
+	}
+	b.sign(&req)
+	_, ok := a.HandleSeek(req)
+	assert.False(t, ok)
+	assert.Equal(t, 0, a.KnownIDs())
+
+	// signed too long ago
+	req.To = a.ID()
+	b.sign(&req)
+	req.Time -= int64(2 * SignatureWindow / time.Second)
+	req.Sig = nil
+	bs, err := req.Marshal()
+	assert.NoError(t, err)
+	req.Sig = b.Identity.Sign(bs)
+	assert.True(t, req.Verify())
+	_, ok = a.HandleSeek(req)
+	assert.False(t, ok)
+	assert.Equal(t, 0, a.KnownIDs())
+
+	// accepted once
+	b.sign(&req)
+	_, ok = a.HandleSeek(req)
+	assert.True(t, ok)
+	assert.Equal(t, 1, a.KnownIDs())
+	a.RemoveNodeID(b.ID(), false)
+
+	// then replayed
+	_, ok = a.HandleSeek(req)
+	assert.False(t, ok)
+	assert.Equal(t, 0, a.KnownIDs())
+}
+
+func TestSeekerSignatures(t *testing.T) {
+	a := newSignedNode(t)
+	b := newSignedNode(t)
+	c := newSignedNode(t)
+	a.RequireSignatures = true
+	a.AddNodeID(b.ID(), false)
+
+	s := a.Seek(c.ID())
+	ok, to, req := s.Next()
+	assert.True(t, ok)
+	assert.Equal(t, b.ID(), to)
+	assert.True(t, req.Verify())
+
+	resp := SeekResponse{
+		ID:    req.ID,
+		Nodes: []dht.Contact{{ID: c.ID()}},
+	}
+	assert.False(t, s.Handle(resp))
+
+	c.sign(&resp)
+	assert.False(t, s.Handle(resp))
+
+	resp, ok = b.HandleSeek(req)
+	assert.True(t, ok)
+	assert.True(t, s.Handle(resp))
+}
+
+func TestFindValueSignatures(t *testing.T) {
+	a := newSignedNode(t)
+	b := newSignedNode(t)
+	c := newSignedNode(t)
+	a.RequireSignatures = true
+	a.AddNodeID(b.ID(), false)
+	key := dht.NodeID{64, 111, 222}
+	b.Store(key, []byte("value"))
+
+	s := a.FindValue(key)
+	ok, to, req := s.NextFindValue()
+	assert.True(t, ok)
+	assert.Equal(t, b.ID(), to)
+	assert.True(t, req.Verify())
+
+	resp := FindValueResponse{
+		ID:    req.ID,
+		Value: []byte("forged"),
+	}
+	assert.False(t, s.HandleFindValue(resp))
+
+	c.sign(&resp)
+	assert.False(t, s.HandleFindValue(resp))
+	assert.Nil(t, s.Result())
+
+	resp, ok = b.HandleFindValue(req)
+	assert.True(t, ok)
+	assert.True(t, resp.Verify())
+	bs, err := resp.Marshal()
+	assert.NoError(t, err)
+	var out FindValueResponse
+	assert.NoError(t, out.Unmarshal(bs))
+	assert.True(t, out.Verify())
+	assert.True(t, s.HandleFindValue(out))
+	assert.Equal(t, []byte("value"), s.Result())
+}
+
+func TestRequireSignaturesRequests(t *testing.T) {
+	a := newSignedNode(t)
+	b := newSignedNode(t)
+	a.RequireSignatures = true
+	key := newSignedNode(t).ID()
+
+	// an unsigned Ping is answered but the sender is not learned, other
+	// unsigned requests are not answered
+	a.HandlePing(Ping{ID: []byte{1}, From: b.ID()})
+	_, ok := a.HandleFindValue(FindValueRequest{ID: []byte{2}, Key: key, From: b.ID()})
+	assert.False(t, ok)
+	resp := a.HandleStore(StoreRequest{ID: []byte{3}, Key: key, From: b.ID(), Value: []byte("value")})
+	assert.False(t, resp.Stored)
+	assert.Equal(t, 0, a.KnownIDs())
+
+	sr := b.StoreRequest(a.ID(), key, []byte("value"))
+	assert.True(t, sr.Verify())
+	assert.True(t, a.HandleStore(sr).Stored)
+	assert.Equal(t, 1, a.KnownIDs())
+	// a replayed StoreRequest is not stored again
+	a.DeleteValue(key)
+	assert.False(t, a.HandleStore(sr).Stored)
+
+	p := Ping{ID: []byte{4}, To: a.ID()}
+	b.sign(&p)
+	bs, err := p.Marshal()
+	assert.NoError(t, err)
+	var out Ping
+	assert.NoError(t, out.Unmarshal(bs))
+	assert.True(t, out.Verify())
+	out.To = b.ID()
+	assert.False(t, out.Verify())
+}
+
+func TestHandleLeaveSignatures(t *testing.T) {
+	a := newSignedNode(t)
+	b := newSignedNode(t)
+	a.RequireSignatures = true
+	addr := netip.MustParseAddrPort("10.0.0.1:5555")
+	a.AddContact(dht.Contact{ID: b.ID(), Addrs: []netip.AddrPort{addr}}, false)
+
+	a.HandleLeave(Leave{ID: []byte{1}, From: b.ID()}, addr)
+	_, ok := a.Contact(b.ID())
+	assert.True(t, ok)
+
+	l := Leave{ID: []byte{2}, To: a.ID()}
+	b.sign(&l)
+	a.HandleLeave(l, addr)
+	_, ok = a.Contact(b.ID())
+	assert.False(t, ok)
+}
@@ -1,27 +1,25 @@
 package sim
 
 import (
+	"context"
 	"crypto/rand"
-	"encoding/base64"
+	"errors"
 	"github.com/dist-ribut-us/dht"
 	"github.com/dist-ribut-us/dht/dhtnetwork"
 	mr "math/rand"
 	"time"
 )
 
-var encodeToString = base64.URLEncoding.EncodeToString
-
 const idLen = 32
 
-type seekResponseHandler interface {
-	Handle(dhtnetwork.SeekResponse) bool
-}
+var errNotSent = errors.New("message not sent")
 
 type Node struct {
 	net           *dhtnetwork.Node
 	gv            *GodView
 	send          chan interface{}
-	waiting       *waiting
+	rpc           *dhtnetwork.RPC
+	refresher     *dhtnetwork.Refresher
 	runningUpdate bool
 }
 
@@ -33,30 +31,33 @@ func (gv *GodView) AddNode() {
 	rand.Read(id)
 
 	n := &Node{
-		net:     dhtnetwork.New(id, 64),
-		gv:      gv,
-		send:    make(chan interface{}, 300),
-		waiting: newwaiting(),
+		net:  dhtnetwork.New(id, 64, nil),
+		gv:   gv,
+		send: make(chan interface{}, 300),
+		rpc:  dhtnetwork.NewRPC(time.Millisecond * 80),
 	}
 
+	n.refresher = n.net.Refresher()
+	n.refresher.Interval = gv.UpdateFreq
 	gv.add(n)
 	go n.run()
 }
 
 func (n *Node) run() {
-	for i := 0; i < 10; i++ {
-		n.net.AddNodeID(n.gv.RandID(), true)
-	}
 	go n.runUpdate()
 STOP:
 	for {
 		switch msg := (<-n.send).(type) {
 		case stop:
+			n.leave()
 			break STOP
 		case dhtnetwork.SeekRequest:
 			n.handleSeekRequest(msg)
 		case dhtnetwork.SeekResponse:
 			n.handleSeekResponse(msg)
+		case dhtnetwork.Leave:
+			// the sim has no addresses, but it's channels can't be spoofed
+			n.net.RemoveNodeID(msg.From, false)
 		case runUpdate:
 			go n.runUpdate()
 		}
@@ -66,17 +67,44 @@ STOP:
 }
 
 func (n *Node) handleSeekRequest(req dhtnetwork.SeekRequest) {
-	n.gv.Send(req.From, n.net.HandleSeek(req))
+	if resp, ok := n.net.HandleSeek(req); ok {
+		n.gv.Send(req.From, resp)
+	}
 }
 
 func (n *Node) handleSeekResponse(resp dhtnetwork.SeekResponse) {
-	idStr := encodeToString(resp.ID)
-	h, _ := n.waiting.get(idStr)
-	if h == nil {
-		return
+	n.rpc.Respond(resp.ID, resp)
+}
+
+// leave tells the closest neighbours that the node is leaving.
+func (n *Node) leave() {
+	l := dhtnetwork.Leave{
+		ID:   dhtnetwork.NewRequestID(),
+		From: n.net.ID(),
 	}
-	n.waiting.delete(idStr)
-	h.Handle(resp)
+	for _, id := range n.net.SeekN(n.net.ID(), dhtnetwork.DefaultLeaveNeighbours, false) {
+		n.gv.Send(id, l)
+	}
+}
+
+// join the network using a few random nodes as seeds.
+func (n *Node) join() {
+	seeds := make([]dht.Contact, 3)
+	for i := range seeds {
+		seeds[i].ID = n.gv.RandID()
+	}
+	n.net.JoinWith(context.Background(), seeds, nil, n.runLookup)
+}
+
+func (n *Node) runLookup(ctx context.Context, l dhtnetwork.Lookup) error {
+	return n.rpc.Run(ctx, l, n.sendSeek)
+}
+
+func (n *Node) sendSeek(id dht.NodeID, sr dhtnetwork.SeekRequest) error {
+	if !n.gv.Send(id, sr) {
+		return errNotSent
+	}
+	return nil
 }
 
 func (n *Node) runUpdate() {
@@ -91,29 +119,12 @@ func (n *Node) runUpdate() {
 	}
 	n.runningUpdate = true
 
-	for n.net.KnownIDs() < 20 {
-		n.net.AddNodeID(n.gv.RandID(), true)
+	if n.net.KnownIDs() < 20 {
+		n.join()
 	}
 
-	u := n.net.Update()
-	for ok, id, sr := u.Next(); ok; ok, id, sr = u.Next() {
-		srIDstr := encodeToString(sr.ID)
-		n.waiting.set(srIDstr, u)
-		if !n.gv.Send(id, sr) {
-			n.waiting.delete(srIDstr)
-			u.HandleNoResponse(sr.ID)
-			continue
-		}
-
-		notHandled := true
-		for i := 0; notHandled == true && i < 20; time.Sleep(time.Millisecond * 4) {
-			i++
-			_, notHandled = n.waiting.get(srIDstr)
-		}
-		if notHandled {
-			n.waiting.delete(srIDstr)
-			u.HandleNoResponse(sr.ID)
-		}
+	if u := n.refresher.Updater(); u != nil {
+		n.runLookup(context.Background(), u)
 	}
 	n.runningUpdate = false
 }
@@ -128,22 +139,6 @@ func (n *Node) Seek(target dht.NodeID) bool {
 		return b
 	}
 
-	for ok, id, sr := s.Next(); ok; ok, id, sr = s.Next() {
-		srIDstr := encodeToString(sr.ID)
-		n.waiting.set(srIDstr, s)
-		n.gv.Send(id, sr)
-		time.Sleep(time.Millisecond * 2)
-
-		notHandled := true
-		for i := 0; notHandled == true && i < 20; time.Sleep(time.Millisecond * 4) {
-			i++
-			_, notHandled = n.waiting.get(srIDstr)
-		}
-		if notHandled {
-			n.waiting.delete(srIDstr)
-			s.HandleNoResponse(sr.ID)
-		}
-	}
-
+	n.runLookup(context.Background(), s)
 	return found
 }
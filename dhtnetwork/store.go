@@ -0,0 +1,289 @@
+package dhtnetwork
+
+import (
+	"crypto/ed25519"
+	"github.com/dist-ribut-us/dht"
+	"github.com/dist-ribut-us/serial"
+)
+
+// StoreRequest asks a node to hold a value under a key.
+type StoreRequest struct {
+	// Request ID
+	ID []byte
+	// Key the value is stored under
+	Key dht.NodeID
+	// Node that is storing the value (so a response can be sent)
+	From  dht.NodeID
+	Value []byte
+	// Node the request is sent to and the Unix time it was signed at.
+	To   dht.NodeID
+	Time int64
+	// Public and Sig are set by Sign, they are empty if the request is unsigned.
+	Public []byte
+	Sig    []byte
+}
+
+var storeRequestPrefixLengths = []int{2, 2, 2, 2, -8, 1, 1, 0}
+
+// Marshal serializes the StoreRequest
+func (s *StoreRequest) Marshal() ([]byte, error) {
+	data := [][]byte{
+		s.ID,
+		s.Key,
+		s.From,
+		s.To,
+		marshalTime(s.Time),
+		s.Public,
+		s.Sig,
+		s.Value,
+	}
+	return serial.MarshalByteSlices(storeRequestPrefixLengths, data)
+}
+
+// Unmarshal deserializes the StoreRequest
+func (s *StoreRequest) Unmarshal(b []byte) error {
+	data, err := serial.UnmarshalByteSlices(storeRequestPrefixLengths, b)
+	if err != nil {
+		return err
+	}
+	s.ID = data[0]
+	s.Key = data[1]
+	s.From = data[2]
+	s.To = orNil(data[3])
+	s.Time = unmarshalTime(data[4])
+	s.Public = orNil(data[5])
+	s.Sig = orNil(data[6])
+	s.Value = data[7]
+	return nil
+}
+
+// StoreResponse is returned after a StoreRequest and indicates if the value
+// was stored.
+type StoreResponse struct {
+	ID     []byte
+	Stored bool
+}
+
+var storeResponsePrefixLengths = []int{1, -1}
+
+// Marshal serializes the StoreResponse
+func (s *StoreResponse) Marshal() ([]byte, error) {
+	stored := []byte{0}
+	if s.Stored {
+		stored[0] = 1
+	}
+	data := [][]byte{
+		s.ID,
+		stored,
+	}
+	return serial.MarshalByteSlices(storeResponsePrefixLengths, data)
+}
+
+// Unmarshal deserializes the StoreResponse
+func (s *StoreResponse) Unmarshal(b []byte) error {
+	data, err := serial.UnmarshalByteSlices(storeResponsePrefixLengths, b)
+	if err != nil {
+		return err
+	}
+	s.ID = data[0]
+	s.Stored = data[1][0] == 1
+	return nil
+}
+
+// FindValueRequest asks a node for the value stored under Key. A node that
+// does not hold the value responds with closer nodes, the same as a
+// SeekRequest.
+type FindValueRequest struct {
+	// Request ID
+	ID []byte
+	// Key of the value being sought
+	Key dht.NodeID
+	// Node that is seeking (so a response can be sent)
+	From dht.NodeID
+	// Node the request is sent to and the Unix time it was signed at.
+	To   dht.NodeID
+	Time int64
+	// Public and Sig are set by Sign, they are empty if the request is unsigned.
+	Public []byte
+	Sig    []byte
+}
+
+var findValueRequestPrefixLengths = []int{2, 2, 2, 2, -8, 1, 0}
+
+// Marshal serializes the FindValueRequest
+func (f *FindValueRequest) Marshal() ([]byte, error) {
+	data := [][]byte{
+		f.ID,
+		f.Key,
+		f.From,
+		f.To,
+		marshalTime(f.Time),
+		f.Public,
+		f.Sig,
+	}
+	return serial.MarshalByteSlices(findValueRequestPrefixLengths, data)
+}
+
+// Unmarshal deserializes the FindValueRequest
+func (f *FindValueRequest) Unmarshal(b []byte) error {
+	data, err := serial.UnmarshalByteSlices(findValueRequestPrefixLengths, b)
+	if err != nil {
+		return err
+	}
+	f.ID = data[0]
+	f.Key = data[1]
+	f.From = data[2]
+	f.To = orNil(data[3])
+	f.Time = unmarshalTime(data[4])
+	f.Public = orNil(data[5])
+	f.Sig = orNil(data[6])
+	return nil
+}
+
+// FindValueResponse is returned after a FindValueRequest with either the Value
+// or Nodes that are closer to the key.
+type FindValueResponse struct {
+	ID    []byte
+	Value []byte
+	Nodes []dht.Contact
+	// From, Public and Sig are set by Sign, they are empty if the response is
+	// unsigned.
+	From   dht.NodeID
+	Public []byte
+	Sig    []byte
+}
+
+var findValueResponsePrefixLengths = []int{1, 2, 1, 1, 2, 0}
+
+// maxIDSize is the longest NodeID or request ID that MaxValueSize leaves room
+// for.
+const maxIDSize = 64
+
+// storeRequestOverhead is the most a signed StoreRequest adds to it's value:
+// the request ID, Key, From and To with 2 byte lengths, the 8 byte Time and the
+// public key and signature with 1 byte lengths. A FindValueResponse adds less.
+const storeRequestOverhead = 4*(2+maxIDSize) + 8 + 1 + ed25519.PublicKeySize + 1 + ed25519.SignatureSize
+
+// MaxValueSize is the largest value that is stored. A StoreRequest or
+// FindValueResponse holding it fits in a single MaxDatagramSize packet.
+const MaxValueSize = MaxDatagramSize - envelopeHeader - storeRequestOverhead
+
+// Marshal serializes the FindValueResponse
+func (f *FindValueResponse) Marshal() ([]byte, error) {
+	nbs, err := marshalContacts(f.Nodes)
+	if err != nil {
+		return nil, err
+	}
+	data := [][]byte{
+		f.ID,
+		f.From,
+		f.Public,
+		f.Sig,
+		f.Value,
+		nbs,
+	}
+	return serial.MarshalByteSlices(findValueResponsePrefixLengths, data)
+}
+
+// Unmarshal deserializes the FindValueResponse
+func (f *FindValueResponse) Unmarshal(b []byte) error {
+	data, err := serial.UnmarshalByteSlices(findValueResponsePrefixLengths, b)
+	if err != nil {
+		return err
+	}
+	f.ID = data[0]
+	f.From = orNil(data[1])
+	f.Public = orNil(data[2])
+	f.Sig = orNil(data[3])
+	f.Value = orNil(data[4])
+	f.Nodes, err = unmarshalContacts(data[5])
+	return err
+}
+
+// Store saves the value under key in the local records. It returns false if
+// the value is larger than MaxValueSize and was not stored.
+func (n *Node) Store(key dht.NodeID, value []byte) bool {
+	if len(value) > MaxValueSize {
+		return false
+	}
+	cp := make([]byte, len(value))
+	copy(cp, value)
+	n.records.set(key.String(), cp)
+	return true
+}
+
+// Value returns the value stored locally under key and a bool indicating if it
+// was found.
+func (n *Node) Value(key dht.NodeID) ([]byte, bool) {
+	return n.records.get(key.String())
+}
+
+// DeleteValue removes the value stored locally under key.
+func (n *Node) DeleteValue(key dht.NodeID) {
+	n.records.delete(key.String())
+}
+
+// StoreRequest creates a StoreRequest for the key and value to send to the node
+// to. It is signed if the Node has an Identity.
+func (n *Node) StoreRequest(to, key dht.NodeID, value []byte) StoreRequest {
+	sr := StoreRequest{
+		ID:    NewRequestID(),
+		Key:   key,
+		From:  n.ID(),
+		Value: value,
+		To:    to,
+	}
+	n.sign(&sr)
+	return sr
+}
+
+// HandleStore takes a StoreRequest and saves the value in the local records. A
+// value is only stored if the request is accepted by the signature policy, the
+// key is a valid ID length and the value is not empty or larger than
+// MaxValueSize.
+func (n *Node) HandleStore(r StoreRequest) StoreResponse {
+	if !n.acceptsRequest(&r, r.ID, r.To, r.Time) {
+		return StoreResponse{ID: r.ID}
+	}
+	n.learn(r.From)
+	return n.store(r)
+}
+
+// store the value from an accepted StoreRequest.
+func (n *Node) store(r StoreRequest) StoreResponse {
+	resp := StoreResponse{
+		ID: r.ID,
+	}
+	if len(r.Key) == n.IDlen && len(r.Value) > 0 {
+		resp.Stored = n.Store(r.Key, r.Value)
+	}
+	return resp
+}
+
+// HandleFindValue takes a FindValueRequest and returns the value if it is held
+// locally, otherwise it returns closer nodes up to length ReturnNodes. If the
+// request is not accepted by the signature policy there is no response and the
+// bool is false. The response is signed if the Node has an Identity.
+func (n *Node) HandleFindValue(r FindValueRequest) (FindValueResponse, bool) {
+	if !n.acceptsRequest(&r, r.ID, r.To, r.Time) {
+		return FindValueResponse{}, false
+	}
+	n.learn(r.From)
+	resp := n.findValueResponse(r)
+	n.sign(&resp)
+	return resp, true
+}
+
+// findValueResponse returns the value or closer nodes for a FindValueRequest
+// without learning the sender or signing the response.
+func (n *Node) findValueResponse(r FindValueRequest) FindValueResponse {
+	resp := FindValueResponse{
+		ID: r.ID,
+	}
+	if v, ok := n.Value(r.Key); ok {
+		resp.Value = v
+	} else {
+		resp.Nodes = n.SeekContacts(r.Key, n.ReturnNodes, true)
+	}
+	return resp
+}
@@ -0,0 +1,179 @@
+package dhtnetwork
+
+import (
+	"github.com/dist-ribut-us/dht"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestStoreRoundTrip(t *testing.T) {
+	req := StoreRequest{
+		ID:    []byte{1, 2, 3},
+		Key:   dht.NodeID{64, 111, 222},
+		From:  dht.NodeID{31, 41, 59},
+		Value: []byte("this is a test"),
+	}
+
+	b, err := req.Marshal()
+	assert.NoError(t, err)
+
+	var out StoreRequest
+	assert.NoError(t, out.Unmarshal(b))
+	assert.Equal(t, req, out)
+
+	resp := StoreResponse{
+		ID:     []byte{1, 2, 3},
+		Stored: true,
+	}
+
+	b, err = resp.Marshal()
+	assert.NoError(t, err)
+
+	var outResp StoreResponse
+	assert.NoError(t, outResp.Unmarshal(b))
+	assert.Equal(t, resp, outResp)
+}
+
+func TestFindValueRoundTrip(t *testing.T) {
+	req := FindValueRequest{
+		ID:   []byte{1, 2, 3},
+		Key:  dht.NodeID{64, 111, 222},
+		From: dht.NodeID{31, 41, 59},
+	}
+
+	b, err := req.Marshal()
+	assert.NoError(t, err)
+
+	var out FindValueRequest
+	assert.NoError(t, out.Unmarshal(b))
+	assert.Equal(t, req, out)
+
+	resp := FindValueResponse{
+		ID: []byte{1, 2, 3},
+		Nodes: []dht.Contact{
+			{ID: dht.NodeID{64, 111, 222}},
+			{ID: dht.NodeID{128, 111, 222}},
+		},
+	}
+
+	b, err = resp.Marshal()
+	assert.NoError(t, err)
+
+	var outResp FindValueResponse
+	assert.NoError(t, outResp.Unmarshal(b))
+	assert.Equal(t, resp, outResp)
+
+	resp = FindValueResponse{
+		ID:    []byte{1, 2, 3},
+		Value: []byte("this is a test"),
+		Nodes: []dht.Contact{},
+	}
+
+	b, err = resp.Marshal()
+	assert.NoError(t, err)
+
+	assert.NoError(t, outResp.Unmarshal(b))
+	assert.Equal(t, resp, outResp)
+}
+
+func TestHandleStore(t *testing.T) {
+	n := New([]byte{1, 10, 15}, 4, nil)
+	key := dht.NodeID{128, 111, 222}
+	val := []byte("this is a test")
+
+	resp := n.HandleStore(StoreRequest{
+		ID:    []byte{1, 2, 3},
+		Key:   key,
+		From:  dht.NodeID{64, 111, 222},
+		Value: val,
+	})
+	assert.True(t, resp.Stored)
+	assert.Equal(t, 1, n.KnownIDs())
+
+	v, ok := n.Value(key)
+	assert.True(t, ok)
+	assert.Equal(t, val, v)
+
+	resp = n.HandleStore(StoreRequest{
+		ID:    []byte{1, 2, 3},
+		Key:   dht.NodeID{1, 2},
+		Value: val,
+	})
+	assert.False(t, resp.Stored)
+	big := dht.NodeID{64, 111, 222}
+	resp = n.HandleStore(StoreRequest{
+		ID:    []byte{1, 2, 3},
+		Key:   big,
+		Value: make([]byte, MaxValueSize+1),
+	})
+	assert.False(t, resp.Stored)
+	_, ok = n.Value(big)
+	assert.False(t, ok)
+	assert.True(t, n.Store(big, make([]byte, MaxValueSize)))
+	fv, ok := n.HandleFindValue(FindValueRequest{ID: []byte{1}, Key: big})
+	assert.True(t, ok)
+	_, err := fv.Marshal()
+	assert.NoError(t, err)
+}
+
+func TestMaxValueSize(t *testing.T) {
+	id, err := dht.GenerateIdentity()
+	assert.NoError(t, err)
+	long := make([]byte, maxIDSize)
+	value := make([]byte, MaxValueSize)
+
+	sr := StoreRequest{
+		ID:    long,
+		Key:   long,
+		To:    long,
+		Value: value,
+	}
+	assert.NoError(t, sr.Sign(id))
+	fv := FindValueResponse{
+		ID:    long,
+		Value: value,
+	}
+	assert.NoError(t, fv.Sign(id))
+
+	tr, err := ListenUDP("127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer tr.Close()
+	for _, msg := range []Message{&sr, &fv} {
+		b, err := Encode(msg, 0)
+		assert.NoError(t, err)
+		assert.True(t, len(b) <= MaxDatagramSize, len(b))
+		assert.NoError(t, tr.Send(b, tr.Addr()))
+	}
+}
+
+func TestFindValue(t *testing.T) {
+	key := dht.NodeID{128 + 64, 111, 222}
+	val := []byte("this is a test")
+
+	a := New([]byte{1, 10, 15}, 4, nil)
+	b := New([]byte{128, 10, 15}, 4, nil)
+	c := New([]byte{128 + 64, 10, 15}, 4, nil)
+	a.AddNodeID(b.ID(), false)
+	b.AddNodeID(c.ID(), false)
+	c.Store(key, val)
+
+	nodes := map[string]*Node{
+		b.ID().String(): b,
+		c.ID().String(): c,
+	}
+
+	s := a.FindValue(key)
+	for ok, id, fv := s.NextFindValue(); ok; ok, id, fv = s.NextFindValue() {
+		resp, _ := nodes[id.String()].HandleFindValue(fv)
+		s.HandleFindValue(resp)
+	}
+	assert.Equal(t, val, s.Value)
+	assert.Equal(t, 3, s.Successes)
+
+	s = c.FindValue(key)
+	ok, _, _ := s.NextFindValue()
+	assert.False(t, ok)
+	assert.Equal(t, val, s.Value)
+}
@@ -0,0 +1,116 @@
+package dhtnetwork
+
+import (
+	"github.com/dist-ribut-us/dht"
+)
+
+// Termination is the reason a Seeker stopped.
+type Termination byte
+
+// Termination reasons
+const (
+	// Running means the Seeker has not stopped.
+	Running Termination = iota
+	// Accepted means Accept returned true for a response.
+	Accepted
+	// FoundValue means a FindValue Seeker found the value.
+	FoundValue
+	// Converged means the k closest nodes of a FindClosest Seeker have all
+	// responded.
+	Converged
+	// Stalled means StallRounds rounds in a row did not find a closer node.
+	Stalled
+	// Exhausted means there were no more nodes to query.
+	Exhausted
+)
+
+var terminationStrings = []string{"running", "accepted", "found value", "converged", "stalled", "exhausted"}
+
+func (t Termination) String() string {
+	if int(t) < len(terminationStrings) {
+		return terminationStrings[t]
+	}
+	return "unknown"
+}
+
+// DefaultStallRounds is the StallRounds a Seeker is created with.
+const DefaultStallRounds = 3
+
+// DefaultK is the StallK a Seeker is created with, unless it is created with
+// FindClosest.
+const DefaultK = 8
+
+// Reason returns why the Seeker stopped or Running if it has not.
+func (s *Seeker) Reason() Termination {
+	s.RLock()
+	defer s.RUnlock()
+	if s.done {
+		return s.reason
+	}
+	if s.isDone() {
+		return Exhausted
+	}
+	return Running
+}
+
+func (s *Seeker) finish(reason Termination) {
+	s.done = true
+	s.reason = reason
+}
+
+// bestK returns the number of closest nodes that are watched for progress.
+func (s *Seeker) bestK() int {
+	if s.StallK < 1 {
+		return 1
+	}
+	return s.StallK
+}
+
+// worstBest returns the furthest of the best k queued nodes or nil if fewer
+// than k nodes are queued.
+func (s *Seeker) worstBest() dht.NodeID {
+	if k := s.bestK(); len(s.queue) >= k {
+		return s.queue[k-1]
+	}
+	return nil
+}
+
+// endRound counts a response towards the current round. A round is Alpha
+// responses. Once StallRounds rounds in a row fail to find a node closer than
+// the best k, the Seeker is done as soon as the best k have all been queried.
+func (s *Seeker) endRound(progress bool) {
+	s.progress = s.progress || progress
+	s.roundResponses++
+	if s.roundResponses >= s.alpha() {
+		if s.progress {
+			s.stalls = 0
+		} else {
+			s.stalls++
+		}
+		s.roundResponses = 0
+		s.progress = false
+	}
+	if !s.done && s.StallRounds > 0 && s.stalls >= s.StallRounds && s.bestQueried() {
+		s.finish(Stalled)
+	}
+}
+
+// bestQueried returns true if all of the best k nodes that have not failed
+// have been sent a request.
+func (s *Seeker) bestQueried() bool {
+	k := s.bestK()
+	for _, id := range s.queue {
+		if k == 0 {
+			break
+		}
+		idStr := id.String()
+		if s.failed[idStr] {
+			continue
+		}
+		if !s.sent[idStr] {
+			return false
+		}
+		k--
+	}
+	return true
+}
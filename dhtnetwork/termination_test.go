@@ -0,0 +1,89 @@
+package dhtnetwork
+
+import (
+	"github.com/dist-ribut-us/dht"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSeekerStalls(t *testing.T) {
+	n := New([]byte{1, 10, 15}, 4, nil)
+	for _, id := range []dht.NodeID{{128, 0, 0}, {129, 0, 0}, {130, 0, 0}, {131, 0, 0}} {
+		n.AddNodeID(id, false)
+	}
+
+	s := n.Seek(dht.NodeID{128, 0, 1})
+	assert.Equal(t, DefaultStallRounds, s.StallRounds)
+	s.SkipUpdate = true
+	s.Alpha = 1
+	s.StallRounds = 2
+	s.StallK = 2
+	assert.Equal(t, Running, s.Reason())
+
+	ok, id, sr := s.Next()
+	assert.True(t, ok)
+	assert.Equal(t, dht.NodeID{128, 0, 0}, id)
+	s.Handle(SeekResponse{ID: sr.ID})
+	assert.Equal(t, Running, s.Reason())
+
+	// stalled, but {130, 0, 0} is now one of the best 2 and has not been
+	// queried
+	ok, _, sr = s.Next()
+	assert.True(t, ok)
+	s.HandleNoResponse(sr.ID)
+	assert.Equal(t, Running, s.Reason())
+
+	ok, id, sr = s.Next()
+	assert.True(t, ok)
+	assert.Equal(t, dht.NodeID{130, 0, 0}, id)
+	s.Handle(SeekResponse{ID: sr.ID})
+	assert.Equal(t, Stalled, s.Reason())
+	assert.True(t, s.Done())
+	ok, _, _ = s.Next()
+	assert.False(t, ok)
+}
+
+func TestSeekerProgressResetsStall(t *testing.T) {
+	n := New([]byte{1, 10, 15}, 4, nil)
+	n.AddNodeID(dht.NodeID{128, 0, 0}, false)
+	target := dht.NodeID{128, 0, 1}
+
+	s := n.Seek(target)
+	s.SkipUpdate = true
+	s.Alpha = 1
+	s.StallRounds = 1
+	ok, _, sr := s.Next()
+	assert.True(t, ok)
+	s.Handle(SeekResponse{
+		ID:    sr.ID,
+		Nodes: []dht.Contact{{ID: dht.NodeID{128, 0, 3}}},
+	})
+	assert.Equal(t, Running, s.Reason())
+
+	ok, _, sr = s.Next()
+	assert.True(t, ok)
+	s.Handle(SeekResponse{ID: sr.ID})
+	assert.Equal(t, Stalled, s.Reason())
+}
+
+func TestSeekerReason(t *testing.T) {
+	n := New([]byte{1, 10, 15}, 4, nil)
+	target := dht.NodeID{128, 0, 1}
+	n.AddNodeID(target, false)
+
+	s := n.Seek(target)
+	s.Accept = Search(target)
+	ok, id, sr := s.Next()
+	assert.True(t, ok)
+	s.Handle(SeekResponse{
+		ID:    sr.ID,
+		Nodes: []dht.Contact{{ID: id}},
+	})
+	assert.Equal(t, Accepted, s.Reason())
+	assert.Equal(t, "accepted", s.Reason().String())
+
+	s = n.Seek(target)
+	_, _, sr = s.Next()
+	s.HandleNoResponse(sr.ID)
+	assert.Equal(t, Exhausted, s.Reason())
+}
@@ -0,0 +1,73 @@
+package dhtnetwork
+
+import (
+	"net"
+	"net/netip"
+)
+
+// Transport sends and receives packets for a Node.
+type Transport interface {
+	// Send the packet to the address.
+	Send(b []byte, to netip.AddrPort) error
+	// Receive blocks until a packet arrives and returns it with the address it
+	// was sent from.
+	Receive() ([]byte, netip.AddrPort, error)
+	Close() error
+}
+
+// MaxPacketSize is the largest packet UDP will receive.
+const MaxPacketSize = 65535
+
+// MaxDatagramSize is the largest payload a UDP packet can carry over IPv4.
+const MaxDatagramSize = 65507
+
+// UDP is a Transport over a UDP socket.
+type UDP struct {
+	conn *net.UDPConn
+	buf  []byte
+}
+
+// ListenUDP creates a UDP Transport listening on the address, such as
+// "127.0.0.1:0".
+func ListenUDP(addr string) (*UDP, error) {
+	laddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		return nil, err
+	}
+	return &UDP{
+		conn: conn,
+		buf:  make([]byte, MaxPacketSize),
+	}, nil
+}
+
+// Addr returns the local address of the socket.
+func (u *UDP) Addr() netip.AddrPort {
+	return u.conn.LocalAddr().(*net.UDPAddr).AddrPort()
+}
+
+// Send the packet to the address.
+func (u *UDP) Send(b []byte, to netip.AddrPort) error {
+	_, err := u.conn.WriteToUDPAddrPort(b, to)
+	return err
+}
+
+// Receive blocks until a packet arrives. It should only be called from one go
+// routine at a time.
+func (u *UDP) Receive() ([]byte, netip.AddrPort, error) {
+	l, from, err := u.conn.ReadFromUDPAddrPort(u.buf)
+	if err != nil {
+		return nil, from, err
+	}
+	b := make([]byte, l)
+	copy(b, u.buf[:l])
+	return b, netip.AddrPortFrom(from.Addr().Unmap(), from.Port()), nil
+}
+
+// Close the socket.
+func (u *UDP) Close() error {
+	return u.conn.Close()
+}
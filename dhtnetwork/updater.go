@@ -1,54 +1,94 @@
 package dhtnetwork
 
 import (
-	"crypto/rand"
 	"github.com/dist-ribut-us/dht"
+	"math/bits"
+	"net/netip"
 	"sync"
+	"time"
 )
 
 type action struct {
 	idx int
 	dht.NodeID
 	target dht.NodeID
+	sent   time.Time
 }
 
 func (u *Updater) seekRequest(a action) (dht.NodeID, SeekRequest) {
 	sr := SeekRequest{
-		ID:           make([]byte, DefaultIDLen),
+		ID:           NewRequestID(),
 		Target:       a.target,
 		From:         u.network.ID(),
+		To:           a.NodeID,
 		MustBeCloser: true,
 	}
-	rand.Read(sr.ID)
+	u.network.sign(&sr)
+	a.sent = time.Now()
 	u.waiting[encodeToString(sr.ID)] = a
 	return a.NodeID, sr
 }
 
 // Updater will manage updating the network connections
 type Updater struct {
+	// Alpha is the most requests that can be waiting on a response at once.
+	// Later requests are chosen from the responses to earlier ones, so sending
+	// them all at once would lose that.
+	Alpha   int
 	network *Node
 	queue   []action
 	waiting map[string]action
 	queued  map[string]bool
+	addrs   addrBook
 	idx     int
 	depth   int
+	// indexes, if not nil, are the only bucket indexes the Updater walks.
+	indexes []int
 	sync.RWMutex
 }
 
+// defaultUpdateDepth is used as the Updater depth until the network size can be
+// estimated with reasonable confidence.
+const defaultUpdateDepth = 10
+
 // Update returns and Updater that will update the links that keep the node
-// connected to the network.
+// connected to the network. The number of bucket indexes it walks scales with
+// the estimated size of the network.
 func (n *Node) Update() *Updater {
-	u := &Updater{
+	u := n.newUpdater()
+	u.depth = n.updateDepth()
+	u.queueIdx(0)
+	return u
+}
+
+// UpdateIndexes returns an Updater that only updates the links for the given
+// bucket indexes.
+func (n *Node) UpdateIndexes(indexes []int) *Updater {
+	u := n.newUpdater()
+	u.indexes = make([]int, len(indexes))
+	copy(u.indexes, indexes)
+	return u
+}
+
+func (n *Node) newUpdater() *Updater {
+	return &Updater{
+		Alpha:   DefaultAlpha,
 		network: n,
 		waiting: make(map[string]action),
 		queued:  make(map[string]bool),
-		depth:   10,
+		addrs:   make(addrBook),
 		idx:     1,
 	}
+}
 
-	u.queueIdx(0)
-
-	return u
+// updateDepth is the number of bucket indexes, after the first, that an
+// Updater walks before skipping to the last. It scales with the estimated size
+// of the network.
+func (n *Node) updateDepth() int {
+	if size, confidence := n.EstimateNetworkSize(); confidence >= 0.5 {
+		return bits.Len(uint(size)) + 1
+	}
+	return defaultUpdateDepth
 }
 
 func (u *Updater) queueIdx(idx int) bool {
@@ -75,6 +115,20 @@ func (u *Updater) queueIdx(idx int) bool {
 	return true
 }
 
+func (u *Updater) alpha() int {
+	if u.Alpha < 1 {
+		return 1
+	}
+	return u.Alpha
+}
+
+// InFlight returns the number of requests waiting on a response.
+func (u *Updater) InFlight() int {
+	u.RLock()
+	defer u.RUnlock()
+	return len(u.waiting)
+}
+
 func (u *Updater) queueLen() int {
 	u.RLock()
 	l := len(u.queue)
@@ -84,15 +138,28 @@ func (u *Updater) queueLen() int {
 
 // Next returns a bool indication if the SeekRequest is valid, the node to send
 // the SeekRequest to and a SeekRequest. It is meant to be used with a loop.
+// Next returns false while Alpha requests are in flight.
 func (u *Updater) Next() (bool, dht.NodeID, SeekRequest) {
 	var ln int
 	links := len(u.network.ID()) * 8
 
+	if u.InFlight() >= u.alpha() {
+		return false, nil, SeekRequest{}
+	}
+
 	ln = u.queueLen()
 
 	// By lazy populating the queue, as responses come back, that can be used in
 	// later requests.
 	for ; ln == 0; ln = u.queueLen() {
+		if u.indexes != nil {
+			if len(u.indexes) == 0 {
+				return false, nil, SeekRequest{}
+			}
+			u.queueIdx(u.indexes[0])
+			u.indexes = u.indexes[1:]
+			continue
+		}
 		if u.idx >= links {
 			return false, nil, SeekRequest{}
 		}
@@ -115,25 +182,32 @@ func (u *Updater) Handle(r SeekResponse) bool {
 	u.RLock()
 	a, found := u.waiting[idStr]
 	u.RUnlock()
-	if !found {
+	if !found || !u.network.acceptsResponse(&r, r.From, a.NodeID) {
 		return false
 	}
 	u.Lock()
 	delete(u.waiting, idStr)
 	u.Unlock()
-	u.network.AddNodeID(a.NodeID, true)
+	u.network.touch(a.NodeID)
+	u.network.AddContact(dht.Contact{
+		ID:       a.NodeID,
+		Addrs:    u.Addrs(a.NodeID),
+		LastSeen: time.Now(),
+		RTT:      time.Since(a.sent),
+	}, true)
 	updated := false
 	updated = len(r.Nodes) > 0
 	u.Lock()
-	for _, id := range r.Nodes {
-		k := id.String() + a.target.String()
+	u.addrs.learn(r.Nodes)
+	for _, c := range r.Nodes {
+		k := c.ID.String() + a.target.String()
 		if u.queued[k] {
 			continue
 		}
 		u.queued[k] = true
 		u.queue = append(u.queue, action{
 			target: a.target,
-			NodeID: id,
+			NodeID: c.ID,
 			idx:    a.idx,
 		})
 	}
@@ -141,7 +215,18 @@ func (u *Updater) Handle(r SeekResponse) bool {
 	return updated
 }
 
-// HandleNoResponse updates the Updater when the request is never answered.
+// Addrs returns the addresses for a NodeID returned by Next. They are taken
+// from the responses the Updater has handled or from the routing table.
+func (u *Updater) Addrs(id dht.NodeID) []netip.AddrPort {
+	u.RLock()
+	addrs := u.addrs.lookup(u.network, id)
+	u.RUnlock()
+	return addrs
+}
+
+// HandleNoResponse updates the Updater when the request is never answered. If
+// the network has a Transport the node is pinged and only banned if that fails
+// too.
 func (u *Updater) HandleNoResponse(requestID []byte) {
 	idStr := encodeToString(requestID)
 	u.RLock()
@@ -153,6 +238,20 @@ func (u *Updater) HandleNoResponse(requestID []byte) {
 	u.Lock()
 	delete(u.waiting, idStr)
 	u.Unlock()
-	u.network.RemoveNodeID(a.NodeID, true)
+	u.network.Failed(a.NodeID)
+	if u.network.Transport == nil {
+		u.network.Ban(a.NodeID, "no response")
+	} else {
+		go u.pingOrBan(dht.Contact{
+			ID:    a.NodeID,
+			Addrs: u.Addrs(a.NodeID),
+		})
+	}
 	u.queueIdx(a.idx)
 }
+
+func (u *Updater) pingOrBan(c dht.Contact) {
+	if !u.network.Alive(c) {
+		u.network.Ban(c.ID, "no response")
+	}
+}
@@ -0,0 +1,181 @@
+package dht
+
+import (
+	"math"
+	"math/bits"
+	"sync"
+)
+
+// estimateSteps is the most Newton steps EstimateNetworkSize takes and
+// tailTerms the most terms used to sum the tail of a full bucket's count.
+const (
+	estimateSteps = 8
+	tailTerms     = 64
+)
+
+// EstimateNetworkSize uses the density of known IDs to estimate the number of
+// nodes in the network, including this one. The bucket at depth d covers
+// 1/2^(d+1) of the ID space so, if IDs are evenly distributed, it should hold
+// that share of the network. A bucket that has evicted IDs to it's replacement
+// cache may have dropped some, so it's count, including the replacements, is
+// only used as a lower bound. The confidence is between 0 and 1 and grows with
+// the number of IDs the estimate is based on; with no known IDs it is 0. The
+// result is cached until the routing table changes.
+func (n *Node) EstimateNetworkSize() (int, float64) {
+	e := n.estimate
+	e.Lock()
+	defer e.Unlock()
+	if e.valid && e.version == n.tree.getVersion() {
+		return e.size, e.confidence
+	}
+	bs, version := n.tree.bucketCounts()
+	e.size, e.confidence = bs.estimate()
+	e.version, e.valid = version, true
+	return e.size, e.confidence
+}
+
+// sizeEstimate caches the result of EstimateNetworkSize for a version of the
+// tree.
+type sizeEstimate struct {
+	version    uint64
+	valid      bool
+	size       int
+	confidence float64
+	sync.Mutex
+}
+
+// bucketCount is the number of unpinned IDs at a depth, including replacements,
+// and a bool indicating the bucket has had IDs evicted.
+type bucketCount struct {
+	count int
+	full  bool
+}
+
+type bucketCounts []bucketCount
+
+// bucketCounts returns the counts for each depth of the tree and the version of
+// the tree they were taken from. A bucket is full if it's replacement cache is
+// not empty.
+func (t *tree) bucketCounts() (bucketCounts, uint64) {
+	t.RLock()
+	defer t.RUnlock()
+	bs := make(bucketCounts, len(t.id)*8)
+	for _, c := range t.root.contacts(nil) {
+		if !c.Pinned {
+			bs[t.id.commonPrefix(c.ID)].count++
+		}
+	}
+	p := t.root
+	for d := range bs[:len(bs)-1] {
+		if p == nil {
+			break
+		}
+		bit := t.id.Bit(uint(d))
+		if sibling := p.branches[bit^1]; sibling != nil {
+			reps := len(sibling.replacements)
+			bs[d].count += reps
+			bs[d].full = reps > 0 && reps >= int(sibling.allowed)
+		}
+		p = p.branches[bit]
+	}
+	return bs, t.version
+}
+
+// estimate returns the network size and confidence for the counts. The count
+// of each bucket is Poisson distributed with a mean of it's share of the other
+// nodes, so if no bucket is full the most likely number of other nodes is the
+// total count over the total share. Otherwise that is only a starting point and
+// a few Newton steps on the log of the size find the most likely size given
+// that the full buckets held at least their count.
+func (bs bucketCounts) estimate() (int, float64) {
+	var known int
+	var count, share float64
+	for d, b := range bs {
+		known += b.count
+		count += float64(b.count)
+		share += math.Ldexp(1, -(d + 1))
+	}
+	if known == 0 {
+		return 1, 0
+	}
+
+	x := math.Log(count / share)
+	for i := 0; i < estimateSteps; i++ {
+		slope, curve := bs.derivatives(x)
+		if curve >= 0 {
+			break
+		}
+		step := math.Max(-1, math.Min(1, -slope/curve))
+		x += step
+		if math.Abs(step) < 1e-3 {
+			break
+		}
+	}
+
+	size := int(math.Round(math.Exp(x))) + 1
+	if size <= known {
+		size = known + 1
+	}
+	return size, 1 - 1/math.Sqrt(float64(known+1))
+}
+
+// derivatives returns the first and second derivatives of the log-likelihood of
+// the counts if there are e^x other nodes in the network. The count of a bucket
+// that is not full is Poisson distributed, a full bucket only says the count is
+// at least what it holds.
+func (bs bucketCounts) derivatives(x float64) (float64, float64) {
+	var slope, curve float64
+	lambda := math.Exp(x)
+	for _, b := range bs {
+		lambda /= 2
+		if !b.full {
+			slope += float64(b.count) - lambda
+			curve -= lambda
+			continue
+		}
+		// h is the rate the log of the probability of holding at least count
+		// grows with lambda.
+		h := 1 / tailRatio(b.count, lambda)
+		slope += lambda * h
+		curve += lambda * h * (float64(b.count) - lambda - lambda*h)
+	}
+	return slope, curve
+}
+
+// tailRatio returns the probability that a Poisson variable with mean lambda is
+// at least k, over the probability that it is k-1. k must be at least 1.
+func tailRatio(k int, lambda float64) float64 {
+	if lambda < float64(k) {
+		// the terms of the upper tail shrink by at least lambda/k each step
+		var sum float64
+		term := 1.0
+		for i := k; i < k+tailTerms; i++ {
+			term *= lambda / float64(i)
+			sum += term
+			if term < 1e-12*sum {
+				break
+			}
+		}
+		return sum
+	}
+	// below k-1 the terms shrink going down, so sum them from the top
+	var below float64
+	term := 1.0
+	for i := k - 1; i >= 0; i-- {
+		below += term
+		term *= float64(i) / lambda
+	}
+	lg, _ := math.Lgamma(float64(k))
+	pmf := math.Exp(float64(k-1)*math.Log(lambda) - lambda - lg)
+	return 1/pmf - below
+}
+
+// commonPrefix returns the number of leading bits n shares with n2.
+func (n NodeID) commonPrefix(n2 NodeID) int {
+	for i := range n {
+		if x := n[i] ^ n2[i]; x != 0 {
+			return i*8 + bits.LeadingZeros8(x)
+		}
+	}
+	return len(n) * 8
+}
@@ -0,0 +1,94 @@
+package dht
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func TestCommonPrefix(t *testing.T) {
+	assert.Equal(t, 0, NodeID{128, 0}.commonPrefix(NodeID{0, 0}))
+	assert.Equal(t, 9, NodeID{64, 128}.commonPrefix(NodeID{64, 192}))
+	assert.Equal(t, 16, NodeID{1, 2}.commonPrefix(NodeID{1, 2}))
+}
+
+func TestEstimateNetworkSize(t *testing.T) {
+	n := New([]byte{0, 0, 0}, 16, nil)
+	size, confidence := n.EstimateNetworkSize()
+	assert.Equal(t, 1, size)
+	assert.Equal(t, 0.0, confidence)
+
+	// Evenly space 15 IDs at 1/16 intervals from the node
+	for i := byte(1); i < 16; i++ {
+		n.AddNodeID(NodeID{i * 16, 0, 0}, false)
+	}
+	size, confidence = n.EstimateNetworkSize()
+	assert.Equal(t, 16, size)
+	assert.InDelta(t, 0.75, confidence, 0.01)
+}
+
+func TestFuzzEstimateNetworkSize(t *testing.T) {
+	ln := 10
+	var logRatio, confidence float64
+	for i := 0; i < FuzzLoops; i++ {
+		n := New(randID(ln), 64, nil)
+		for j := 0; j < 1000; j++ {
+			n.AddNodeID(randID(ln), false)
+		}
+		size, c := n.EstimateNetworkSize()
+		assert.True(t, size > 100 && size < 10000, size)
+		logRatio += math.Log(float64(size) / 1001)
+		confidence += c
+	}
+	// the estimate should not be biased by pruning
+	assert.InDelta(t, 0, logRatio/FuzzLoops, 0.25)
+	assert.True(t, confidence/FuzzLoops > 0.5)
+}
+
+func TestEstimateNetworkSizeCached(t *testing.T) {
+	n := New(randID(16), 8, nil)
+	for i := 0; i < 100; i++ {
+		n.AddNodeID(randID(16), false)
+	}
+	size, _ := n.EstimateNetworkSize()
+	version := n.estimate.version
+	n.EstimateNetworkSize()
+	assert.Equal(t, version, n.estimate.version)
+
+	// adding an ID invalidates the cache
+	n.AddNodeID(randID(16), false)
+	n.EstimateNetworkSize()
+	assert.NotEqual(t, version, n.estimate.version)
+
+	// the cached result is the same as a new estimate
+	bs, _ := n.tree.bucketCounts()
+	size, confidence := bs.estimate()
+	cachedSize, cachedConfidence := n.EstimateNetworkSize()
+	assert.Equal(t, size, cachedSize)
+	assert.Equal(t, confidence, cachedConfidence)
+}
+
+func benchmarkNode(ln, ids int) *Node {
+	n := New(randID(ln), 8, nil)
+	for i := 0; i < ids; i++ {
+		n.AddNodeID(randID(ln), false)
+	}
+	return n
+}
+
+func BenchmarkEstimateNetworkSize(b *testing.B) {
+	n := benchmarkNode(16, 300)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		n.EstimateNetworkSize()
+	}
+}
+
+func BenchmarkEstimateNetworkSizeUncached(b *testing.B) {
+	n := benchmarkNode(16, 300)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bs, _ := n.tree.bucketCounts()
+		bs.estimate()
+	}
+}
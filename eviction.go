@@ -0,0 +1,50 @@
+package dht
+
+import (
+	"sort"
+)
+
+// EvictionPolicy chooses which contacts to drop when a bucket holds more than
+// it's allowed links. Evict is called while the routing table is locked, so it
+// must not call back into the Node (such as Contact or KnownIDs) or it will
+// deadlock. Anything it needs should be in the contacts it is given or held by
+// the policy itself.
+type EvictionPolicy interface {
+	// Evict is given the contacts in an overflowing bucket, ordered stalest
+	// first, and the number that must be removed. It returns the IDs of the
+	// contacts to remove. If fewer than n valid IDs are returned, the stalest
+	// of the remaining contacts are also removed.
+	Evict(bucket []Contact, n int) []NodeID
+}
+
+// EvictionFunc allows a function to be used as an EvictionPolicy.
+type EvictionFunc func(bucket []Contact, n int) []NodeID
+
+// Evict calls fn.
+func (fn EvictionFunc) Evict(bucket []Contact, n int) []NodeID {
+	return fn(bucket, n)
+}
+
+// StaleFirst is the default EvictionPolicy. It removes the contacts with the
+// most failures, then those seen least recently, then those added most
+// recently.
+type StaleFirst struct{}
+
+// Evict returns the n stalest contacts in the bucket.
+func (StaleFirst) Evict(bucket []Contact, n int) []NodeID {
+	sorted := make([]*Contact, len(bucket))
+	for i := range bucket {
+		sorted[i] = &bucket[i]
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].staler(sorted[j])
+	})
+	if n > len(sorted) {
+		n = len(sorted)
+	}
+	ids := make([]NodeID, n)
+	for i, c := range sorted[:n] {
+		ids[i] = c.ID
+	}
+	return ids
+}
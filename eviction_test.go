@@ -0,0 +1,168 @@
+package dht
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestStaleFirst(t *testing.T) {
+	now := time.Now()
+	bucket := []Contact{
+		{ID: NodeID{1}, LastSeen: now},
+		{ID: NodeID{2}},
+		{ID: NodeID{3}, LastSeen: now, Failures: 2},
+		{ID: NodeID{4}, LastSeen: now.Add(-time.Minute)},
+	}
+	ids := StaleFirst{}.Evict(bucket, 3)
+	assert.Equal(t, []NodeID{{3}, {2}, {4}}, ids)
+	assert.Len(t, StaleFirst{}.Evict(bucket, 10), 4)
+}
+
+func TestEvictionPolicy(t *testing.T) {
+	slowest := EvictionFunc(func(bucket []Contact, n int) []NodeID {
+		var ids []NodeID
+		for _, c := range bucket {
+			if c.RTT > time.Second {
+				ids = append(ids, c.ID)
+			}
+		}
+		return ids
+	})
+	n := New([]byte{0, 0, 0}, 2, slowest)
+	now := time.Now()
+	n.AddContact(Contact{ID: NodeID{128, 0, 1}, LastSeen: now, RTT: 2 * time.Second}, false)
+	n.AddContact(Contact{ID: NodeID{129, 0, 1}, LastSeen: now, RTT: time.Millisecond}, false)
+	n.AddContact(Contact{ID: NodeID{130, 0, 1}}, false)
+	n.tree.prune()
+
+	_, found := n.Contact(NodeID{128, 0, 1})
+	assert.False(t, found)
+	_, found = n.Contact(NodeID{130, 0, 1})
+	assert.True(t, found)
+
+	// the policy does not choose enough, so the stalest is also removed
+	n.AddContact(Contact{ID: NodeID{131, 0, 1}, LastSeen: now, RTT: 3 * time.Second}, false)
+	n.AddContact(Contact{ID: NodeID{132, 0, 1}, LastSeen: now}, false)
+	n.tree.prune()
+	assert.Equal(t, 2, n.KnownIDs())
+	_, found = n.Contact(NodeID{131, 0, 1})
+	assert.False(t, found)
+	_, found = n.Contact(NodeID{130, 0, 1})
+	assert.False(t, found)
+}
+
+func TestVerifyEvicted(t *testing.T) {
+	n := New([]byte{0, 0, 0}, 2, nil)
+	alive := NodeID{128, 0, 1}
+	release := make(chan bool)
+	verified := make(chan NodeID, 10)
+	n.Verify = func(c Contact) bool {
+		<-release
+		verified <- c.ID
+		return c.ID.Equal(alive)
+	}
+	now := time.Now()
+	n.AddContact(Contact{ID: alive, LastSeen: now.Add(-time.Hour)}, false)
+	for i := byte(1); i < 4; i++ {
+		n.AddContact(Contact{ID: NodeID{128 + i, 0, 1}, LastSeen: now}, false)
+		time.Sleep(time.Millisecond)
+	}
+
+	// contacts are not evicted while they are being verified
+	assert.Equal(t, 4, n.KnownIDs())
+	_, found := n.Contact(alive)
+	assert.True(t, found)
+
+	close(release)
+	timeout := time.After(time.Second)
+	got := map[string]bool{}
+	for len(got) < 2 {
+		select {
+		case id := <-verified:
+			got[id.String()] = true
+		case <-timeout:
+			t.Fatal("contacts chosen for eviction were not verified")
+		}
+	}
+	assert.True(t, got[alive.String()])
+	assert.True(t, got[NodeID{131, 0, 1}.String()])
+	for i := 0; i < 100 && n.KnownIDs() > 2; i++ {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the live contact is kept, the dead one is evicted and the newest contact
+	// is moved to the replacement cache
+	assert.Equal(t, 2, n.KnownIDs())
+	c, found := n.Contact(alive)
+	assert.True(t, found)
+	assert.True(t, c.LastSeen.After(now))
+	_, found = n.Contact(NodeID{129, 0, 1})
+	assert.True(t, found)
+	_, found = n.Contact(NodeID{130, 0, 1})
+	assert.False(t, found)
+
+	n.RemoveNodeID(NodeID{129, 0, 1}, false)
+	_, found = n.Contact(NodeID{130, 0, 1})
+	assert.True(t, found)
+}
+
+func TestVerifyConcurrent(t *testing.T) {
+	n := New([]byte{0, 0, 0}, 2, nil)
+	started := make(chan NodeID, 2)
+	release := make(chan bool)
+	n.Verify = func(c Contact) bool {
+		started <- c.ID
+		<-release
+		return true
+	}
+	now := time.Now()
+	first, second := NodeID{128, 0, 1}, NodeID{129, 0, 1}
+	n.AddContact(Contact{ID: first, LastSeen: now.Add(-2 * time.Hour)}, false)
+	time.Sleep(time.Millisecond)
+	n.AddContact(Contact{ID: second, LastSeen: now.Add(-time.Hour)}, false)
+	for i := byte(2); i < 4; i++ {
+		time.Sleep(time.Millisecond)
+		n.AddContact(Contact{ID: NodeID{128 + i, 0, 1}, LastSeen: now}, false)
+	}
+
+	// both stale contacts are verified at the same time and the bucket holds
+	// all four until they are done
+	timeout := time.After(time.Second)
+	got := map[string]bool{}
+	for len(got) < 2 {
+		select {
+		case id := <-started:
+			got[id.String()] = true
+		case <-timeout:
+			t.Fatal("contacts chosen for eviction were not verified")
+		}
+	}
+	assert.True(t, got[first.String()])
+	assert.True(t, got[second.String()])
+	assert.Equal(t, 4, n.KnownIDs())
+
+	close(release)
+	for i := 0; i < 100 && n.KnownIDs() > 2; i++ {
+		time.Sleep(time.Millisecond)
+	}
+
+	// whichever finishes first moves the newest contact out, the other moves
+	// the next newest by Added rather than the contact verified before it
+	assert.Equal(t, 2, n.KnownIDs())
+	for _, id := range []NodeID{first, second} {
+		_, found := n.Contact(id)
+		assert.True(t, found)
+	}
+	_, found := n.Contact(NodeID{130, 0, 1})
+	assert.False(t, found)
+	_, found = n.Contact(NodeID{131, 0, 1})
+	assert.False(t, found)
+
+	// the contact moved last is restored first
+	n.RemoveNodeID(first, false)
+	_, found = n.Contact(NodeID{130, 0, 1})
+	assert.True(t, found)
+	_, found = n.Contact(NodeID{131, 0, 1})
+	assert.False(t, found)
+}
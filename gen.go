@@ -5,24 +5,24 @@ import (
 )
 
 type blacklist struct {
-	Map map[string]bool
+	Map map[string]*Ban
 	sync.RWMutex
 }
 
 func newblacklist() *blacklist {
 	return &blacklist{
-		Map: make(map[string]bool),
+		Map: make(map[string]*Ban),
 	}
 }
 
-func (t *blacklist) get(key string) (bool, bool) {
+func (t *blacklist) get(key string) (*Ban, bool) {
 	t.RLock()
 	k, b := t.Map[key]
 	t.RUnlock()
 	return k, b
 }
 
-func (t *blacklist) set(key string, val bool) {
+func (t *blacklist) set(key string, val *Ban) {
 	t.Lock()
 	t.Map[key] = val
 	t.Unlock()
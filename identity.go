@@ -0,0 +1,100 @@
+package dht
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"os"
+)
+
+// identityMagic starts every marshaled Identity.
+var identityMagic = []byte("dhti")
+
+// identityVersion is the version of the format written by Identity.Marshal.
+const identityVersion = 1
+
+// ErrIdentityFormat is returned when unmarshaling something that is not an
+// Identity.
+var ErrIdentityFormat = errors.New("not a dht identity")
+
+// Identity is an Ed25519 key pair and the NodeID derived from it's public key.
+// Because the NodeID is the hash of the key, a node can't choose it's own
+// position in the network.
+type Identity struct {
+	ID      NodeID
+	Public  ed25519.PublicKey
+	private ed25519.PrivateKey
+}
+
+// IDFromKey returns the NodeID for a public key, which is the SHA-256 hash of
+// the key.
+func IDFromKey(pub ed25519.PublicKey) NodeID {
+	h := sha256.Sum256(pub)
+	return NodeID(h[:])
+}
+
+// VerifyID returns true if the NodeID was derived from the public key.
+func VerifyID(id NodeID, pub ed25519.PublicKey) bool {
+	return len(pub) == ed25519.PublicKeySize && id.Equal(IDFromKey(pub))
+}
+
+// GenerateIdentity creates a new Identity from a random key.
+func GenerateIdentity() (*Identity, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return identityFromKey(priv), nil
+}
+
+func identityFromKey(priv ed25519.PrivateKey) *Identity {
+	pub := priv.Public().(ed25519.PublicKey)
+	return &Identity{
+		ID:      IDFromKey(pub),
+		Public:  pub,
+		private: priv,
+	}
+}
+
+// Sign the message with the Identity's private key.
+func (i *Identity) Sign(msg []byte) []byte {
+	return ed25519.Sign(i.private, msg)
+}
+
+// Verify returns true if sig is a valid signature of msg by the key.
+func Verify(pub ed25519.PublicKey, msg, sig []byte) bool {
+	return len(pub) == ed25519.PublicKeySize && ed25519.Verify(pub, msg, sig)
+}
+
+// Marshal the Identity, including it's private key.
+func (i *Identity) Marshal() []byte {
+	b := make([]byte, 0, len(identityMagic)+1+ed25519.SeedSize)
+	b = append(b, identityMagic...)
+	b = append(b, identityVersion)
+	return append(b, i.private.Seed()...)
+}
+
+// UnmarshalIdentity reads an Identity written by Marshal.
+func UnmarshalIdentity(b []byte) (*Identity, error) {
+	l := len(identityMagic)
+	if len(b) != l+1+ed25519.SeedSize || !bytes.Equal(b[:l], identityMagic) || b[l] != identityVersion {
+		return nil, ErrIdentityFormat
+	}
+	return identityFromKey(ed25519.NewKeyFromSeed(b[l+1:])), nil
+}
+
+// Save writes the Identity to a file that only the owner can read.
+func (i *Identity) Save(path string) error {
+	return os.WriteFile(path, i.Marshal(), 0600)
+}
+
+// LoadIdentity reads an Identity from a file written by Save.
+func LoadIdentity(path string) (*Identity, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return UnmarshalIdentity(b)
+}
@@ -0,0 +1,43 @@
+package dht
+
+import (
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestIdentity(t *testing.T) {
+	id, err := GenerateIdentity()
+	assert.NoError(t, err)
+	assert.Len(t, id.ID, 32)
+	assert.True(t, VerifyID(id.ID, id.Public))
+
+	other, err := GenerateIdentity()
+	assert.NoError(t, err)
+	assert.False(t, VerifyID(id.ID, other.Public))
+	assert.False(t, VerifyID(id.ID, nil))
+
+	msg := []byte("message")
+	sig := id.Sign(msg)
+	assert.True(t, Verify(id.Public, msg, sig))
+	assert.False(t, Verify(other.Public, msg, sig))
+	assert.False(t, Verify(id.Public, []byte("other"), sig))
+}
+
+func TestIdentityPersist(t *testing.T) {
+	id, err := GenerateIdentity()
+	assert.NoError(t, err)
+
+	out, err := UnmarshalIdentity(id.Marshal())
+	assert.NoError(t, err)
+	assert.Equal(t, id, out)
+
+	path := filepath.Join(t.TempDir(), "identity")
+	assert.NoError(t, id.Save(path))
+	out, err = LoadIdentity(path)
+	assert.NoError(t, err)
+	assert.Equal(t, id, out)
+
+	_, err = UnmarshalIdentity([]byte("dhts"))
+	assert.Equal(t, ErrIdentityFormat, err)
+}
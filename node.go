@@ -2,20 +2,35 @@ package dht
 
 // Node keeps a list of NodeIDs folllowing the linking rules of a DHT.
 type Node struct {
-	id        NodeID
-	blacklist *blacklist
-	tree      *tree
+	// Verify, if set, is called in a new go routine with each contact that has
+	// been seen before it is evicted. If it returns true the contact is still
+	// alive and is kept, the contact added to it's bucket most recently is moved
+	// to the replacement cache instead. Otherwise the contact is evicted. The
+	// bucket can hold more than it's allowed links until Verify returns.
+	Verify     func(Contact) bool
+	id         NodeID
+	blacklist  *blacklist
+	prefixBans *prefixBans
+	tree       *tree
+	estimate   *sizeEstimate
 }
 
-// New creates a DHT Node
-func New(id []byte, startBuffers int) *Node {
+// New creates a DHT Node. The policy is used to choose which contacts to drop
+// when a bucket is full, if it is nil StaleFirst is used.
+func New(id []byte, startBuffers int, policy EvictionPolicy) *Node {
 	if startBuffers < 1 {
 		startBuffers = 1
 	}
+	t := newTree(NodeID(id), startBuffers)
+	if policy != nil {
+		t.policy = policy
+	}
 	return &Node{
-		id:        NodeID(id),
-		blacklist: newblacklist(),
-		tree:      newTree(NodeID(id), startBuffers),
+		id:         NodeID(id),
+		blacklist:  newblacklist(),
+		prefixBans: newPrefixBans(),
+		tree:       t,
+		estimate:   &sizeEstimate{},
 	}
 }
 
@@ -24,37 +39,60 @@ func (n *Node) ID() NodeID {
 	return n.id.Copy()
 }
 
-func (n *Node) blacklisted(idStr string) bool {
-	b, _ := n.blacklist.get(idStr)
-	return b
-}
-
 // AddNodeID will add the id to the list of known ids. If the node is
 // blacklisted it will not be added unless overrideBlacklist.
 func (n *Node) AddNodeID(id NodeID, overrideBlacklist bool) {
-	if id == nil || n.id.Equal(id) {
+	n.AddContact(Contact{ID: id}, overrideBlacklist)
+}
+
+// AddContact will add the contact to the list of known ids. If the id is
+// already known and the contact has a LastSeen time, the existing contact is
+// marked as seen. If the node is blacklisted it will not be added unless
+// overrideBlacklist, which ends the ban early but keeps it's Count so a later
+// ban still escalates. A NodeID under a banned prefix is
+// never added. Contacts can only be pinned with Pin.
+func (n *Node) AddContact(c Contact, overrideBlacklist bool) {
+	if c.ID == nil || n.id.Equal(c.ID) || n.prefixBans.match(c.ID) != nil {
 		return
 	}
 
-	if idStr := id.String(); n.blacklisted(idStr) {
+	if idStr := c.ID.String(); n.blacklisted(idStr) {
 		if overrideBlacklist {
-			n.blacklist.delete(idStr)
+			n.liftBan(idStr)
 		} else {
 			return
 		}
 	}
 
-	n.tree.insert(id)
-	if n.tree.toPrune >= uint(n.tree.startBuffers) {
+	c.Pinned = false
+	addrs := c.Addrs
+	c.Addrs = nil
+	c.addAddrs(addrs)
+	if !n.tree.insertContact(&c) {
+		return
+	}
+	if n.Verify == nil {
 		n.tree.prune()
+		return
+	}
+	for _, e := range n.tree.pruneVerify() {
+		go n.verify(e)
 	}
 }
 
-// RemoveNodeID removes a NodeID. If blacklist is true, the NodeID will be added
-// to the blacklist.
+// verify a contact that was chosen for eviction and keep it if it is alive.
+func (n *Node) verify(c Contact) {
+	n.tree.verified(c.ID, n.Verify(c))
+}
+
+// RemoveNodeID removes a NodeID. If blacklist is true, the NodeID will be
+// banned with the reason "removed". If the NodeID was in a full bucket, the
+// most recently evicted contact for that bucket takes it's place. Pinned
+// NodeIDs are not removed.
 func (n *Node) RemoveNodeID(id NodeID, blacklist bool) {
 	if blacklist {
-		n.blacklist.set(id.String(), true)
+		n.Ban(id, "removed")
+		return
 	}
 	n.tree.remove(id)
 }
@@ -80,6 +118,16 @@ func (n *Node) SeekN(target NodeID, ids int, mustBeCloser bool) []NodeID {
 	return n.tree.searchn(target, ids, c)
 }
 
+// SeekContacts is the same as SeekN, but returns the Contacts so their
+// addresses are included.
+func (n *Node) SeekContacts(target NodeID, ids int, mustBeCloser bool) []Contact {
+	var c NodeID
+	if mustBeCloser {
+		c = n.id.Xor(target)
+	}
+	return n.tree.searchContacts(target, ids, c)
+}
+
 // KnownIDs returns the number of IDs currently stored.
 func (n *Node) KnownIDs() int {
 	return n.tree.descendants()
@@ -6,7 +6,7 @@ import (
 )
 
 func TestNode(t *testing.T) {
-	n := New([]byte{5, 4, 3}, 8)
+	n := New([]byte{5, 4, 3}, 8, nil)
 
 	ns := []NodeID{
 		{128, 100, 123},
@@ -27,7 +27,7 @@ func TestFuzzNode(t *testing.T) {
 	ln := 10
 	addNodes := ln * ln * ln
 	for i := 0; i < FuzzLoops; i++ {
-		n := New(randID(ln), 8)
+		n := New(randID(ln), 8, nil)
 
 		for j := 0; j < addNodes; j++ {
 			n.AddNodeID(randID(ln), false)
@@ -0,0 +1,32 @@
+package dht
+
+// Pin adds the id to the routing table if it is not already known and marks it
+// so it is never pruned or evicted. Pinned ids do not count against a bucket's
+// allowed links and are not removed by RemoveNodeID, Ban or BanPrefix until
+// they are unpinned. Pinning lifts any ban on the id.
+func (n *Node) Pin(id NodeID) {
+	if len(id) != len(n.id) || n.id.Equal(id) {
+		return
+	}
+	n.blacklist.delete(id.String())
+	n.tree.pin(id.Copy())
+}
+
+// Unpin allows the id to be pruned or evicted like any other contact.
+func (n *Node) Unpin(id NodeID) {
+	if len(id) != len(n.id) {
+		return
+	}
+	n.tree.unpin(id)
+}
+
+// Pinned returns the pinned ids.
+func (n *Node) Pinned() []NodeID {
+	var ids []NodeID
+	for _, c := range n.tree.contacts() {
+		if c.Pinned {
+			ids = append(ids, c.ID)
+		}
+	}
+	return ids
+}
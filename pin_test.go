@@ -0,0 +1,66 @@
+package dht
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestPin(t *testing.T) {
+	n := New([]byte{0, 0, 0}, 2, nil)
+	pinned := NodeID{128, 0, 1}
+	n.Pin(pinned)
+	assert.Equal(t, []NodeID{pinned}, n.Pinned())
+
+	now := time.Now()
+	for i := byte(2); i < 10; i++ {
+		n.AddContact(Contact{ID: NodeID{128, 0, i}, LastSeen: now}, false)
+	}
+	n.tree.prune()
+	n.tree.root.checkNestedAllowed(false, 0)
+	// the pinned id does not count against the 2 allowed
+	assert.Equal(t, 3, n.KnownIDs())
+	c, ok := n.Contact(pinned)
+	assert.True(t, ok)
+	assert.True(t, c.Pinned)
+
+	n.RemoveNodeID(pinned, false)
+	n.Ban(pinned, "testing")
+	n.BanPrefix(NodeID{128}, 1, "testing", 0)
+	_, ok = n.Contact(pinned)
+	assert.True(t, ok)
+	assert.Equal(t, 1, n.KnownIDs())
+	n.UnbanPrefix(NodeID{128}, 1)
+
+	n.Pin(pinned)
+	for i := byte(2); i < 10; i++ {
+		n.AddContact(Contact{ID: NodeID{128, 0, i}, LastSeen: now}, false)
+	}
+	n.tree.prune()
+	assert.Equal(t, 3, n.KnownIDs())
+
+	n.Unpin(pinned)
+	assert.Len(t, n.Pinned(), 0)
+	assert.Equal(t, 2, n.KnownIDs())
+	n.tree.root.checkAllowed()
+}
+
+func TestPinContactIgnored(t *testing.T) {
+	n := New([]byte{0, 0, 0}, 2, nil)
+	n.AddContact(Contact{ID: NodeID{128, 0, 1}, Pinned: true}, false)
+	assert.Len(t, n.Pinned(), 0)
+}
+
+func TestSnapshotPinned(t *testing.T) {
+	n := New([]byte{0, 0, 0}, 2, nil)
+	n.Pin(NodeID{128, 0, 1})
+	n.AddNodeID(NodeID{64, 0, 1}, false)
+	buf := &bytes.Buffer{}
+	assert.NoError(t, n.Snapshot(buf))
+
+	r := New([]byte{1, 1, 1}, 2, nil)
+	assert.NoError(t, r.Restore(buf))
+	assert.Equal(t, []NodeID{{128, 0, 1}}, r.Pinned())
+	assert.Equal(t, 2, r.KnownIDs())
+}
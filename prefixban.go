@@ -0,0 +1,180 @@
+package dht
+
+import (
+	"sync"
+	"time"
+)
+
+// PrefixBan blacklists every NodeID that starts with the first Bits bits of
+// Prefix.
+type PrefixBan struct {
+	Prefix  NodeID
+	Bits    uint
+	Reason  string
+	Created time.Time
+	// TTL is how long the ban lasts, if it is 0 the ban does not expire.
+	TTL time.Duration
+}
+
+// Active returns true if the ban has not expired at the given time.
+func (pb PrefixBan) Active(at time.Time) bool {
+	return pb.TTL == 0 || at.Before(pb.Created.Add(pb.TTL))
+}
+
+// Match returns true if id starts with the banned prefix.
+func (pb PrefixBan) Match(id NodeID) bool {
+	if uint(len(id))*8 < pb.Bits {
+		return false
+	}
+	for i := uint(0); i < pb.Bits; i++ {
+		if id.Bit(i) != pb.Prefix.Bit(i) {
+			return false
+		}
+	}
+	return true
+}
+
+// maskPrefix returns a copy of the first bits of prefix with the rest of the
+// last byte set to 0.
+func maskPrefix(prefix NodeID, bits uint) NodeID {
+	ln := (bits + 7) / 8
+	out := make(NodeID, ln)
+	copy(out, prefix[:ln])
+	if r := bits & 7; r != 0 {
+		out[ln-1] &= byte(0xff) << (8 - r)
+	}
+	return out
+}
+
+type banBranch struct {
+	branches [2]*banBranch
+	ban      *PrefixBan
+}
+
+// prefixBans is a binary tree of banned prefixes. Checking an id only walks
+// as deep as the longest ban along it's path.
+type prefixBans struct {
+	root *banBranch
+	sync.RWMutex
+}
+
+func newPrefixBans() *prefixBans {
+	return &prefixBans{
+		root: &banBranch{},
+	}
+}
+
+func (p *prefixBans) add(pb *PrefixBan) {
+	p.Lock()
+	b := p.root
+	for i := uint(0); i < pb.Bits; i++ {
+		bit := pb.Prefix.Bit(i)
+		if b.branches[bit] == nil {
+			b.branches[bit] = &banBranch{}
+		}
+		b = b.branches[bit]
+	}
+	b.ban = pb
+	p.Unlock()
+}
+
+// match returns the first active ban that matches id, or nil.
+func (p *prefixBans) match(id NodeID) *PrefixBan {
+	now := time.Now()
+	p.RLock()
+	defer p.RUnlock()
+	b := p.root
+	ln := uint(len(id)) * 8
+	for i := uint(0); b != nil; i++ {
+		if b.ban != nil && b.ban.Active(now) {
+			return b.ban
+		}
+		if i == ln {
+			break
+		}
+		b = b.branches[id.Bit(i)]
+	}
+	return nil
+}
+
+func (p *prefixBans) remove(prefix NodeID, bits uint) {
+	p.Lock()
+	p.root.remove(prefix, bits, 0)
+	p.Unlock()
+}
+
+// remove returns true if the branch is empty and can be removed.
+func (b *banBranch) remove(prefix NodeID, bits, depth uint) bool {
+	if depth == bits {
+		b.ban = nil
+	} else if next := b.branches[prefix.Bit(depth)]; next != nil {
+		if next.remove(prefix, bits, depth+1) {
+			b.branches[prefix.Bit(depth)] = nil
+		}
+	}
+	return b.ban == nil && b.branches[0] == nil && b.branches[1] == nil
+}
+
+// all returns the active bans and removes any that have expired.
+func (p *prefixBans) all() []PrefixBan {
+	now := time.Now()
+	var bans []PrefixBan
+	var expired []*PrefixBan
+	p.RLock()
+	p.root.each(func(pb *PrefixBan) {
+		if pb.Active(now) {
+			bans = append(bans, *pb)
+		} else {
+			expired = append(expired, pb)
+		}
+	})
+	p.RUnlock()
+	for _, pb := range expired {
+		p.remove(pb.Prefix, pb.Bits)
+	}
+	return bans
+}
+
+func (b *banBranch) each(fn func(*PrefixBan)) {
+	if b.ban != nil {
+		fn(b.ban)
+	}
+	for _, br := range b.branches {
+		if br != nil {
+			br.each(fn)
+		}
+	}
+}
+
+// BanPrefix blacklists every NodeID that starts with the first bits of prefix
+// and removes any that are already known. If ttl is 0 the ban does not
+// expire. Unlike a ban on a single NodeID, a prefix ban is not lifted by
+// overrideBlacklist in AddNodeID.
+func (n *Node) BanPrefix(prefix NodeID, bits uint, reason string, ttl time.Duration) PrefixBan {
+	if max := uint(len(prefix)) * 8; bits > max {
+		bits = max
+	}
+	pb := &PrefixBan{
+		Prefix:  maskPrefix(prefix, bits),
+		Bits:    bits,
+		Reason:  reason,
+		Created: time.Now(),
+		TTL:     ttl,
+	}
+	n.prefixBans.add(pb)
+	n.tree.removeMatching(pb.Match)
+	return *pb
+}
+
+// UnbanPrefix removes the ban on the prefix.
+func (n *Node) UnbanPrefix(prefix NodeID, bits uint) {
+	if max := uint(len(prefix)) * 8; bits > max {
+		bits = max
+	}
+	n.prefixBans.remove(prefix, bits)
+}
+
+// PrefixBans returns all the prefix bans that are still active.
+func (n *Node) PrefixBans() []PrefixBan {
+	return n.prefixBans.all()
+}
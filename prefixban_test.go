@@ -0,0 +1,88 @@
+package dht
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMaskPrefix(t *testing.T) {
+	assert.Equal(t, NodeID{255, 224}, maskPrefix(NodeID{255, 255, 255}, 11))
+	assert.Equal(t, NodeID{255}, maskPrefix(NodeID{255, 255, 255}, 8))
+	assert.Equal(t, NodeID{}, maskPrefix(NodeID{255, 255, 255}, 0))
+}
+
+func TestPrefixBan(t *testing.T) {
+	n := New([]byte{5, 4, 3}, 8, nil)
+	inside := NodeID{128 + 64, 100, 123}
+	outside := NodeID{128, 100, 123}
+	n.AddNodeID(inside, false)
+	n.AddNodeID(outside, false)
+
+	pb := n.BanPrefix(NodeID{128 + 64 + 1}, 2, "sybil", 0)
+	assert.Equal(t, NodeID{128 + 64}, pb.Prefix)
+	assert.Equal(t, 1, n.KnownIDs())
+	_, found := n.Contact(outside)
+	assert.True(t, found)
+
+	n.AddNodeID(NodeID{128 + 64 + 32, 1, 1}, true)
+	assert.Equal(t, 1, n.KnownIDs())
+
+	bans := n.PrefixBans()
+	assert.Len(t, bans, 1)
+	assert.Equal(t, "sybil", bans[0].Reason)
+
+	n.UnbanPrefix(NodeID{128 + 64}, 2)
+	assert.Len(t, n.PrefixBans(), 0)
+	n.AddNodeID(inside, false)
+	assert.Equal(t, 2, n.KnownIDs())
+
+	// nested bans and expiry
+	n.BanPrefix(NodeID{128}, 1, "wide", time.Minute)
+	n.BanPrefix(NodeID{128 + 64}, 3, "narrow", 0)
+	assert.Equal(t, 0, n.KnownIDs())
+	n.prefixBans.root.branches[1].ban.Created = time.Now().Add(-time.Hour)
+	assert.Len(t, n.PrefixBans(), 1)
+	n.AddNodeID(outside, false)
+	n.AddNodeID(inside, false)
+	assert.Equal(t, 1, n.KnownIDs())
+	_, found = n.Contact(outside)
+	assert.True(t, found)
+}
+
+func TestPrefixBanReplacements(t *testing.T) {
+	n := New([]byte{0, 0, 0}, 2, nil)
+	for i := byte(1); i < 5; i++ {
+		n.AddNodeID(NodeID{128 + i, 0, 0}, false)
+	}
+	n.tree.prune()
+	assert.Equal(t, 2, n.KnownIDs())
+
+	n.BanPrefix(NodeID{128}, 1, "all", 0)
+	assert.Equal(t, 0, n.KnownIDs())
+	for _, b := range n.tree.root.branches {
+		if b != nil {
+			assert.Len(t, b.replacements, 0)
+		}
+	}
+}
+
+func TestSnapshotPrefixBans(t *testing.T) {
+	n := New([]byte{5, 4, 3}, 8, nil)
+	n.BanPrefix(NodeID{128 + 64 + 32}, 3, "sybil", time.Hour)
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, n.Snapshot(buf))
+	r := New([]byte{1, 1, 1}, 2, nil)
+	assert.NoError(t, r.Restore(buf))
+
+	bans := r.PrefixBans()
+	assert.Len(t, bans, 1)
+	assert.Equal(t, NodeID{128 + 64 + 32}, bans[0].Prefix)
+	assert.EqualValues(t, 3, bans[0].Bits)
+	assert.Equal(t, time.Hour, bans[0].TTL)
+	assert.Equal(t, "sybil", bans[0].Reason)
+	r.AddNodeID(NodeID{128 + 64 + 32 + 1, 1, 1}, true)
+	assert.Equal(t, 0, r.KnownIDs())
+}
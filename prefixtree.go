@@ -2,7 +2,9 @@ package dht
 
 import (
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 )
 
 var _ = fmt.Println
@@ -12,41 +14,81 @@ type prefixBranch struct {
 	allowed     uint
 	toPrune     uint
 	branches    [2]*prefixBranch
-	val         NodeID
+	val         *Contact
+	// pinned is the number of descendants that are pinned, they are not counted
+	// against allowed.
+	pinned uint
+	// replacements holds contacts evicted from a branch with allowed links so
+	// they can refill it when a leaf is removed.
+	replacements []*Contact
 }
 
-func (p *prefixBranch) insert(id NodeID, depth uint) uint {
+func (p *prefixBranch) insert(c *Contact, depth uint) uint {
+	if len(p.replacements) > 0 {
+		p.dropReplacement(c.ID)
+	}
 	if p.descendants == 0 {
-		p.val = id
+		p.val = c
 		p.descendants = 1
+		p.pinned = 0
+		if c.Pinned {
+			p.pinned = 1
+		}
 		return 0
 	}
 	var valBit byte = 2
 	if p.val != nil {
-		if p.val.Equal(id) {
+		if p.val.ID.Equal(c.ID) {
 			return 0
 		}
-		valBit = p.val.Bit(depth)
+		valBit = p.val.ID.Bit(depth)
 		p.get(valBit).insert(p.val, depth+1)
 		p.val = nil
 	}
-	bit := id.Bit(depth)
-	p.toPrune = p.get(bit).insert(id, depth+1)
+	bit := c.ID.Bit(depth)
+	p.toPrune = p.get(bit).insert(c, depth+1)
 	bit ^= 1
 	if p.branches[bit] != nil && p.toPrune < p.branches[bit].toPrune {
 		p.toPrune = p.branches[bit].toPrune
 	}
 
 	p.descendants++
-	if p.allowed > 0 && p.descendants > p.allowed {
-		if toPrune := p.descendants - p.allowed; toPrune > p.toPrune {
-			p.toPrune = toPrune
-		}
+	if c.Pinned {
+		p.pinned++
+	}
+	if toPrune := p.over(); toPrune > p.toPrune {
+		p.toPrune = toPrune
 	}
 
 	return p.toPrune
 }
 
+// over returns the number of leaves the branch has beyond it's allowed links.
+// Pinned leaves are not counted.
+func (p *prefixBranch) over() uint {
+	if p.allowed == 0 || p.descendants-p.pinned <= p.allowed {
+		return 0
+	}
+	return p.descendants - p.pinned - p.allowed
+}
+
+// count sets descendants and pinned from the branch's val and children.
+func (p *prefixBranch) count() {
+	p.descendants, p.pinned = 0, 0
+	if p.val != nil {
+		p.descendants = 1
+		if p.val.Pinned {
+			p.pinned = 1
+		}
+	}
+	for _, b := range p.branches {
+		if b != nil {
+			p.descendants += b.descendants
+			p.pinned += b.pinned
+		}
+	}
+}
+
 func (p *prefixBranch) get(idx byte) *prefixBranch {
 	branch := p.branches[idx]
 	if branch == nil {
@@ -58,7 +100,7 @@ func (p *prefixBranch) get(idx byte) *prefixBranch {
 
 func (p *prefixBranch) search(target NodeID, depth uint) NodeID {
 	if p.val != nil {
-		return p.val
+		return p.val.ID
 	}
 	bit := target.Bit(depth)
 	if p.branches[bit] != nil && p.branches[bit].descendants > 0 {
@@ -71,9 +113,9 @@ func (p *prefixBranch) search(target NodeID, depth uint) NodeID {
 	return nil
 }
 
-func (p *prefixBranch) searchn(target NodeID, ids []NodeID, closerThan NodeID, depth uint) int {
+func (p *prefixBranch) searchn(target NodeID, ids []*Contact, closerThan NodeID, depth uint) int {
 	if p.val != nil {
-		if closerThan == nil || p.val.Xor(target).Compare(closerThan) == -1 {
+		if closerThan == nil || p.val.ID.Xor(target).Compare(closerThan) == -1 {
 			ids[0] = p.val
 			return 1
 		}
@@ -94,6 +136,39 @@ func (p *prefixBranch) searchn(target NodeID, ids []NodeID, closerThan NodeID, d
 	return filled
 }
 
+// find returns the Contact for id or nil if it is not in the tree.
+func (p *prefixBranch) find(id NodeID, depth uint) *Contact {
+	if p.val != nil {
+		if p.val.ID.Equal(id) {
+			return p.val
+		}
+		return nil
+	}
+	if b := p.branches[id.Bit(depth)]; b != nil && b.descendants > 0 {
+		return b.find(id, depth+1)
+	}
+	return nil
+}
+
+// setPinned sets Pinned on the Contact for id and updates the pinned counts
+// along the path. It returns false if id is not in the branch.
+func (p *prefixBranch) setPinned(id NodeID, pinned bool, depth uint) bool {
+	if p.val != nil {
+		if !p.val.ID.Equal(id) {
+			return false
+		}
+		p.val.Pinned = pinned
+		p.count()
+		return true
+	}
+	b := p.branches[id.Bit(depth)]
+	if b == nil || b.descendants == 0 || !b.setPinned(id, pinned, depth+1) {
+		return false
+	}
+	p.count()
+	return true
+}
+
 func (p *prefixBranch) setAllowed(target NodeID, atDepth, allowed, depth uint) {
 	b := p.get(target.Bit(depth))
 	if depth == atDepth {
@@ -103,84 +178,195 @@ func (p *prefixBranch) setAllowed(target NodeID, atDepth, allowed, depth uint) {
 	b.setAllowed(target, atDepth, allowed, depth+1)
 }
 
-//bool indicates if it's safe to remove this branch after pruning
-func (p *prefixBranch) prune(n uint, seenAllowed bool) bool {
-	canRemove := p.allowed == 0
-	if p.allowed > 0 {
-		seenAllowed = true
+// updateToPrune recalculates toPrune for the branch and all it's descendants.
+// It is used when the allowed links have changed.
+func (p *prefixBranch) updateToPrune() uint {
+	p.toPrune = 0
+	for _, b := range p.branches {
+		if b == nil {
+			continue
+		}
+		if toPrune := b.updateToPrune(); toPrune > p.toPrune {
+			p.toPrune = toPrune
+		}
 	}
+	if toPrune := p.over(); toPrune > p.toPrune {
+		p.toPrune = toPrune
+	}
+	return p.toPrune
+}
 
-	if p.val != nil {
-		// if p.descendants != 1 {
-		// 	panic("oh boy")
-		// }
-		if n > 0 {
-			// if n != 1 {
-			// 	println(n)
-			// 	panic("really bad")
-			// }
-			p.val = nil
-			p.descendants = 0
-		}
-		return canRemove && p.descendants == 0
+// prune removes leaves from any branch over it's allowed links and removes
+// branches that are no longer needed. Leaves in drop are removed. If hold is
+// not nil, any leaf chosen for eviction that hold returns true for is kept. The
+// bool indicates if it's safe to remove this branch after pruning.
+func (p *prefixBranch) prune(drop map[string]bool, policy EvictionPolicy, hold func(*Contact) bool) bool {
+	if over := p.over(); over > 0 {
+		drop = p.evict(over, policy, hold)
 	}
-	if p.allowed > 0 && p.toPrune > n {
-		n = p.toPrune
-		p.toPrune = 0
+	p.toPrune = 0
+
+	if p.val != nil && drop[p.val.ID.String()] {
+		p.val = nil
 	}
 
-	var r uint
-	p.descendants = 0
-	if p.branches[1] != nil {
-		if p.branches[1].descendants < n {
-			r = n - p.branches[1].descendants
+	canRemove := p.allowed == 0 && p.val == nil
+	for i, b := range p.branches {
+		if b == nil {
+			continue
 		}
-		if p.branches[1].prune(n-r, seenAllowed) {
-			p.branches[1] = nil
+		if b.prune(drop, policy, hold) {
+			p.branches[i] = nil
 		} else {
-			p.descendants = p.branches[1].descendants
 			canRemove = false
 		}
-	} else {
-		r = n
 	}
+	p.count()
 
-	// if r > 0 && p.branches[0] == nil {
-	// 	panic("something bad")
-	// }
+	return canRemove && p.descendants == 0
+}
 
-	if p.branches[0] != nil {
-		if p.branches[0].prune(r, seenAllowed) {
-			p.branches[0] = nil
-		} else {
-			canRemove = false
+// evict uses the policy to choose n leaves to remove from the branch. Any that
+// have not failed are kept in the replacement cache. Pinned leaves are never
+// chosen. Leaves that hold returns true for are kept, but still count towards
+// n, so no other leaf is removed in their place.
+func (p *prefixBranch) evict(n uint, policy EvictionPolicy, hold func(*Contact) bool) map[string]bool {
+	var bucket []*Contact
+	for _, c := range p.contacts(nil) {
+		if !c.Pinned {
+			bucket = append(bucket, c)
 		}
 	}
+	sort.SliceStable(bucket, func(i, j int) bool {
+		return bucket[i].staler(bucket[j])
+	})
+	cs := make([]Contact, len(bucket))
+	inBucket := make(map[string]bool, len(bucket))
+	for i, c := range bucket {
+		cs[i] = c.copy()
+		inBucket[c.ID.String()] = true
+	}
 
-	if p.branches[0] != nil {
-		p.descendants += p.branches[0].descendants
+	drop := make(map[string]bool, n)
+	for _, id := range policy.Evict(cs, int(n)) {
+		if uint(len(drop)) == n {
+			break
+		}
+		if idStr := id.String(); inBucket[idStr] {
+			drop[idStr] = true
+		}
+	}
+	for _, c := range bucket {
+		if uint(len(drop)) == n {
+			break
+		}
+		drop[c.ID.String()] = true
+	}
+	if hold != nil {
+		for _, c := range bucket {
+			if idStr := c.ID.String(); drop[idStr] && hold(c) {
+				delete(drop, idStr)
+			}
+		}
 	}
 
-	return canRemove && p.descendants == 0
+	for _, c := range bucket {
+		if drop[c.ID.String()] && c.Failures == 0 {
+			p.addReplacement(c)
+		}
+	}
+	return drop
+}
+
+// contacts appends all the leaves under the branch to cs.
+func (p *prefixBranch) contacts(cs []*Contact) []*Contact {
+	if p.val != nil {
+		cs = append(cs, p.val)
+	}
+	for _, b := range p.branches {
+		if b != nil && b.descendants > 0 {
+			cs = b.contacts(cs)
+		}
+	}
+	return cs
+}
+
+// addReplacement adds the contact to the end of the replacement cache. The
+// cache holds at most as many contacts as the branch allows, the oldest
+// entries are dropped first.
+func (p *prefixBranch) addReplacement(c *Contact) {
+	p.dropReplacement(c.ID)
+	p.replacements = append(p.replacements, c)
+	if over := len(p.replacements) - int(p.allowed); over > 0 {
+		p.replacements = p.replacements[over:]
+	}
 }
 
+func (p *prefixBranch) dropReplacement(id NodeID) {
+	for i, c := range p.replacements {
+		if c.ID.Equal(id) {
+			p.replacements = append(p.replacements[:i], p.replacements[i+1:]...)
+			return
+		}
+	}
+}
+
+// bucket returns the branch with allowed links that id falls under.
+func (p *prefixBranch) bucket(id NodeID, depth uint) *prefixBranch {
+	if p.allowed > 0 {
+		return p
+	}
+	if p.val != nil || depth >= uint(len(id))*8 {
+		return nil
+	}
+	b := p.branches[id.Bit(depth)]
+	if b == nil {
+		return nil
+	}
+	return b.bucket(id, depth+1)
+}
+
+// removeNode removes the id from the branch. If a leaf is removed from a
+// branch with a replacement cache, the most recent replacement is inserted.
+// Pinned leaves are not removed.
 func (p *prefixBranch) removeNode(id NodeID, depth uint) {
 	if p.val != nil {
-		if p.val.Equal(id) {
+		if p.val.ID.Equal(id) && !p.val.Pinned {
 			p.val = nil
 			p.descendants = 0
 		}
+		return
 	}
 
 	bit := id.Bit(depth)
 	if p.branches[bit] == nil {
 		return
 	}
+	before := p.descendants
 	p.branches[bit].removeNode(id, depth+1)
-	p.descendants = p.branches[bit].descendants
-	bit ^= 1
-	if p.branches[bit] != nil {
-		p.descendants += p.branches[bit].descendants
+	p.count()
+
+	if ln := len(p.replacements); ln > 0 && p.descendants < before && p.descendants-p.pinned < p.allowed {
+		c := p.replacements[ln-1]
+		p.replacements = p.replacements[:ln-1]
+		p.insert(c, depth)
+	}
+}
+
+// dropReplacements removes any contact from the replacement caches of the
+// branch and it's descendants if fn returns true for it's ID.
+func (p *prefixBranch) dropReplacements(fn func(NodeID) bool) {
+	kept := p.replacements[:0]
+	for _, c := range p.replacements {
+		if !fn(c.ID) {
+			kept = append(kept, c)
+		}
+	}
+	p.replacements = kept
+	for _, b := range p.branches {
+		if b != nil {
+			b.dropReplacements(fn)
+		}
 	}
 }
 
@@ -189,6 +375,13 @@ type tree struct {
 	id           NodeID
 	toPrune      uint
 	startBuffers int
+	policy       EvictionPolicy
+	// verifying holds the contacts returned by pruneVerify that are waiting
+	// on verified.
+	verifying map[string]bool
+	// version is incremented whenever contacts are added or removed so results
+	// computed from the whole tree can be cached.
+	version uint64
 	sync.RWMutex
 }
 
@@ -197,25 +390,120 @@ func newTree(id NodeID, startBuffers int) *tree {
 		root:         &prefixBranch{},
 		id:           id,
 		startBuffers: startBuffers,
+		policy:       StaleFirst{},
+		verifying:    make(map[string]bool),
 	}
 
-	allowed := uint(startBuffers)
-	ln := uint(len(id))*8 - 1
+	t.setBuffers()
+
+	return t
+}
+
+// setBuffers sets the allowed links at each depth starting from startBuffers
+// and halving at each depth down to a minimum of one.
+func (t *tree) setBuffers() {
+	allowed := uint(t.startBuffers)
+	ln := uint(len(t.id))*8 - 1
 	var i uint
 	for ; allowed > 1 && i < ln; i, allowed = i+1, allowed/2 {
-		t.root.setAllowed(id.FlipBit(int(i)), i, allowed, 0)
+		t.root.setAllowed(t.id.FlipBit(int(i)), i, allowed, 0)
 	}
 	for ; i < ln; i++ {
-		t.root.setAllowed(id.FlipBit(int(i)), i, 1, 0)
+		t.root.setAllowed(t.id.FlipBit(int(i)), i, 1, 0)
 	}
+}
 
-	return t
+// resize changes startBuffers and the allowed links at each depth. If any
+// branch is now over it's allowed links, the tree is pruned.
+func (t *tree) resize(startBuffers int) {
+	t.Lock()
+	t.startBuffers = startBuffers
+	t.setBuffers()
+	t.toPrune = t.root.updateToPrune()
+	if t.toPrune > 0 {
+		t.root.prune(nil, t.policy, nil)
+		t.toPrune = 0
+	}
+	t.version++
+	t.Unlock()
+}
+
+func (t *tree) buffers() int {
+	t.RLock()
+	b := t.startBuffers
+	t.RUnlock()
+	return b
+}
+
+// insert adds the id to the tree and returns true if the tree should be pruned.
+func (t *tree) insert(id NodeID) bool {
+	return t.insertContact(&Contact{ID: id})
+}
+
+// insertContact adds the contact to the tree and returns true if the tree
+// should be pruned. If the id is already in the tree, the liveness of the
+// existing contact is updated.
+func (t *tree) insertContact(c *Contact) bool {
+	if c.Added.IsZero() {
+		c.Added = time.Now()
+	}
+	t.Lock()
+	if existing := t.root.find(c.ID, 0); existing != nil {
+		if !c.LastSeen.IsZero() {
+			existing.seen(c.LastSeen, c.RTT)
+		}
+		existing.addAddrs(c.Addrs)
+		t.Unlock()
+		return false
+	}
+	t.toPrune = t.root.insert(c, 0)
+	prune := t.toPrune >= uint(t.startBuffers)
+	t.version++
+	t.Unlock()
+	return prune
 }
 
-func (t *tree) insert(id NodeID) {
+// contact returns a copy of the Contact for id and a bool indicating if it was
+// found.
+func (t *tree) contact(id NodeID) (Contact, bool) {
+	if len(id) != len(t.id) {
+		return Contact{}, false
+	}
+	t.RLock()
+	c := t.root.find(id, 0)
+	var cp Contact
+	if c != nil {
+		cp = c.copy()
+	}
+	t.RUnlock()
+	return cp, c != nil
+}
+
+// update calls fn with the Contact for id if it is in the tree and returns a
+// bool indicating if it was found.
+func (t *tree) update(id NodeID, fn func(*Contact)) bool {
+	if len(id) != len(t.id) {
+		return false
+	}
 	t.Lock()
-	t.toPrune = t.root.insert(id, 0)
+	c := t.root.find(id, 0)
+	if c != nil {
+		fn(c)
+	}
 	t.Unlock()
+	return c != nil
+}
+
+// contacts returns a copy of every Contact in the tree.
+func (t *tree) contacts() []Contact {
+	t.RLock()
+	ptrs := t.root.contacts(nil)
+	cs := make([]Contact, len(ptrs))
+	for i, c := range ptrs {
+		cs[i] = c.copy()
+	}
+	t.RUnlock()
+	return cs
 }
 
 func (t *tree) search(target NodeID) NodeID {
@@ -227,18 +515,102 @@ func (t *tree) search(target NodeID) NodeID {
 
 func (t *tree) searchn(id NodeID, n int, closerThan NodeID) []NodeID {
 	t.RLock()
-	ids := make([]NodeID, n)
-	filled := t.root.searchn(id, ids, closerThan, 0)
+	cs := make([]*Contact, n)
+	filled := t.root.searchn(id, cs, closerThan, 0)
+	ids := make([]NodeID, filled)
+	for i, c := range cs[:filled] {
+		ids[i] = c.ID
+	}
+	t.RUnlock()
+	return ids
+}
+
+// searchContacts is the same as searchn but returns copies of the Contacts.
+func (t *tree) searchContacts(id NodeID, n int, closerThan NodeID) []Contact {
+	t.RLock()
+	ptrs := make([]*Contact, n)
+	filled := t.root.searchn(id, ptrs, closerThan, 0)
+	cs := make([]Contact, filled)
+	for i, c := range ptrs[:filled] {
+		cs[i] = c.copy()
+	}
 	t.RUnlock()
-	return ids[:filled]
+	return cs
 }
 
 func (t *tree) prune() {
 	t.Lock()
-	t.root.prune(0, false)
+	t.root.prune(nil, t.policy, nil)
+	t.toPrune = 0
+	t.version++
 	t.Unlock()
 }
 
+// pruneVerify prunes the tree, but any contact chosen for eviction that has
+// been seen is kept and returned so it can be verified first. Contacts that are
+// already being verified are kept but not returned again. Each returned contact
+// must be passed to verified.
+func (t *tree) pruneVerify() []Contact {
+	var toVerify []Contact
+	t.Lock()
+	t.root.prune(nil, t.policy, func(c *Contact) bool {
+		if c.LastSeen.IsZero() {
+			return false
+		}
+		if idStr := c.ID.String(); !t.verifying[idStr] {
+			t.verifying[idStr] = true
+			toVerify = append(toVerify, c.copy())
+		}
+		return true
+	})
+	t.toPrune = 0
+	t.version++
+	t.Unlock()
+	return toVerify
+}
+
+// verified records the result of verifying a contact returned by pruneVerify.
+// If it is alive it is marked as seen and, if it's bucket is still over it's
+// allowed links, the contact added most recently is moved to the replacement
+// cache in it's place. Otherwise it is removed. Until then the bucket stays
+// over it's allowed links. The contact moved is chosen by Added, so a contact
+// that was verified more recently can still be moved, and it is restored
+// before contacts that were already in the replacement cache.
+func (t *tree) verified(id NodeID, alive bool) {
+	t.Lock()
+	defer t.Unlock()
+	delete(t.verifying, id.String())
+	t.version++
+	c := t.root.find(id, 0)
+	if c == nil {
+		return
+	}
+	if !alive {
+		c.Failures++
+		t.root.removeNode(id, 0)
+		return
+	}
+	c.seen(time.Now(), 0)
+
+	b := t.root.bucket(id, 0)
+	if b == nil || b.over() == 0 {
+		return
+	}
+	var newest *Contact
+	for _, bc := range b.contacts(nil) {
+		if bc.Pinned || t.verifying[bc.ID.String()] || bc.ID.Equal(id) {
+			continue
+		}
+		if newest == nil || bc.Added.After(newest.Added) {
+			newest = bc
+		}
+	}
+	if newest != nil {
+		t.root.removeNode(newest.ID, 0)
+		b.addReplacement(newest)
+	}
+}
+
 func (t *tree) Len() int {
 	return int(t.root.descendants) - 1
 }
@@ -246,9 +618,57 @@ func (t *tree) Len() int {
 func (t *tree) remove(id NodeID) {
 	t.Lock()
 	t.root.removeNode(id, 0)
+	t.version++
 	t.Unlock()
 }
 
+// removeMatching removes every contact for which fn returns true, including
+// those in replacement caches.
+func (t *tree) removeMatching(fn func(NodeID) bool) {
+	t.Lock()
+	t.root.dropReplacements(fn)
+	for _, c := range t.root.contacts(nil) {
+		if fn(c.ID) {
+			t.root.removeNode(c.ID, 0)
+		}
+	}
+	t.version++
+	t.Unlock()
+}
+
+// pin marks the contact for id as pinned, adding it if it is not in the tree.
+func (t *tree) pin(id NodeID) {
+	t.Lock()
+	if !t.root.setPinned(id, true, 0) {
+		t.root.insert(&Contact{
+			ID:     id,
+			Added:  time.Now(),
+			Pinned: true,
+		}, 0)
+	}
+	t.version++
+	t.Unlock()
+}
+
+// unpin clears Pinned on the contact for id. If that leaves a branch over it's
+// allowed links, the tree is pruned.
+func (t *tree) unpin(id NodeID) {
+	t.Lock()
+	if t.root.setPinned(id, false, 0) && t.root.updateToPrune() > 0 {
+		t.root.prune(nil, t.policy, nil)
+	}
+	t.toPrune = t.root.toPrune
+	t.version++
+	t.Unlock()
+}
+
+func (t *tree) getVersion() uint64 {
+	t.RLock()
+	v := t.version
+	t.RUnlock()
+	return v
+}
+
 func (t *tree) descendants() int {
 	t.RLock()
 	d := int(t.root.descendants)
@@ -3,6 +3,7 @@ package dht
 import (
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestTree(t *testing.T) {
@@ -67,7 +68,7 @@ func TestToPrune(t *testing.T) {
 	tr.insert(NodeID{64, 10, 20})
 	assert.EqualValues(t, 6, tr.toPrune)
 
-	tr.root.prune(0, false)
+	tr.root.prune(nil, tr.policy, nil)
 }
 
 func (p *prefixBranch) checkAllowed() {
@@ -98,3 +99,55 @@ func (p *prefixBranch) checkNestedAllowed(seenAllowed bool, depth int) {
 		p.branches[1].checkNestedAllowed(seenAllowed, depth+1)
 	}
 }
+
+func TestEvictStale(t *testing.T) {
+	tr := newTree(NodeID{0, 0, 0}, 2)
+	now := time.Now()
+	seen := &Contact{ID: NodeID{128, 0, 1}, LastSeen: now}
+	old := &Contact{ID: NodeID{129, 0, 1}, LastSeen: now.Add(-time.Hour)}
+	learned := &Contact{ID: NodeID{130, 0, 1}}
+
+	tr.insertContact(seen)
+	tr.insertContact(old)
+	tr.insertContact(learned)
+	tr.prune()
+	tr.root.checkAllowed()
+	assert.Equal(t, 2, tr.descendants())
+	_, found := tr.contact(learned.ID)
+	assert.False(t, found)
+
+	failed := &Contact{ID: NodeID{131, 0, 1}, LastSeen: now, Failures: 1}
+	tr.insertContact(failed)
+	tr.prune()
+	_, found = tr.contact(failed.ID)
+	assert.False(t, found)
+	_, found = tr.contact(old.ID)
+	assert.True(t, found)
+
+	// learned was not failing so it will replace the first node removed
+	tr.remove(seen.ID)
+	assert.Equal(t, 2, tr.descendants())
+	_, found = tr.contact(learned.ID)
+	assert.True(t, found)
+
+	tr.remove(old.ID)
+	assert.Equal(t, 1, tr.descendants())
+}
+
+func TestReplacementCache(t *testing.T) {
+	p := &prefixBranch{allowed: 2}
+	ids := []NodeID{{1}, {2}, {3}}
+	for _, id := range ids {
+		p.addReplacement(&Contact{ID: id})
+	}
+	assert.Len(t, p.replacements, 2)
+	assert.Equal(t, ids[1], p.replacements[0].ID)
+	assert.Equal(t, ids[2], p.replacements[1].ID)
+
+	p.addReplacement(&Contact{ID: ids[1]})
+	assert.Len(t, p.replacements, 2)
+	assert.Equal(t, ids[1], p.replacements[1].ID)
+
+	p.dropReplacement(ids[2])
+	assert.Len(t, p.replacements, 1)
+}
@@ -0,0 +1,54 @@
+package dht
+
+import (
+	"math/bits"
+)
+
+// minStartBuffers is the fewest links BuffersForSize will allow in the first
+// bucket.
+const minStartBuffers = 4
+
+// BuffersForSize returns the number of links to allow in the first bucket for
+// a network of the given size. It grows with the square root of the size,
+// rounded down to a power of two, so a network of 5000 nodes gets 64.
+func BuffersForSize(size int) int {
+	if size < 1 {
+		return minStartBuffers
+	}
+	b := 1 << uint(bits.Len(uint(size))/2)
+	if b < minStartBuffers {
+		b = minStartBuffers
+	}
+	return b
+}
+
+// Resize changes the number of links allowed in the first bucket, each deeper
+// bucket allows half as many down to a minimum of one. Growing keeps all the
+// existing links and opens capacity for more. Shrinking prunes any bucket that
+// is over it's new limit.
+func (n *Node) Resize(startBuffers int) {
+	if startBuffers < 1 {
+		startBuffers = 1
+	}
+	n.tree.resize(startBuffers)
+}
+
+// ResizeToEstimate resizes the Node using EstimateNetworkSize. If the estimate
+// is not confident enough, the size is not changed. The number of links
+// allowed in the first bucket is returned.
+func (n *Node) ResizeToEstimate() int {
+	size, confidence := n.EstimateNetworkSize()
+	if confidence < 0.5 {
+		return n.tree.buffers()
+	}
+	b := BuffersForSize(size)
+	if b != n.tree.buffers() {
+		n.Resize(b)
+	}
+	return b
+}
+
+// StartBuffers returns the number of links allowed in the first bucket.
+func (n *Node) StartBuffers() int {
+	return n.tree.buffers()
+}
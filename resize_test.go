@@ -0,0 +1,58 @@
+package dht
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBuffersForSize(t *testing.T) {
+	assert.Equal(t, minStartBuffers, BuffersForSize(0))
+	assert.Equal(t, minStartBuffers, BuffersForSize(10))
+	assert.Equal(t, 8, BuffersForSize(100))
+	assert.Equal(t, 64, BuffersForSize(5000))
+	assert.Equal(t, 1024, BuffersForSize(1000000))
+}
+
+func TestResize(t *testing.T) {
+	n := New([]byte{0, 0, 0}, 2, nil)
+	for i := byte(1); i < 128; i++ {
+		n.AddNodeID(NodeID{128 + i, i, 0}, false)
+	}
+	n.tree.prune()
+	assert.Equal(t, 2, n.KnownIDs())
+
+	n.Resize(32)
+	assert.Equal(t, 32, n.StartBuffers())
+	assert.Equal(t, 2, n.KnownIDs())
+	for i := byte(1); i < 128; i++ {
+		n.AddNodeID(NodeID{128 + i, i, 0}, false)
+	}
+	assert.True(t, n.KnownIDs() >= 32)
+	n.tree.prune()
+	assert.Equal(t, 32, n.KnownIDs())
+	n.tree.root.checkAllowed()
+	n.tree.root.checkNestedAllowed(false, 0)
+
+	n.Resize(4)
+	assert.Equal(t, 4, n.KnownIDs())
+	n.tree.root.checkAllowed()
+	n.tree.root.checkNestedAllowed(false, 0)
+}
+
+func TestFuzzResize(t *testing.T) {
+	ln := 10
+	for i := 0; i < FuzzLoops; i++ {
+		n := New(randID(ln), 8, nil)
+		for j := 0; j < 500; j++ {
+			n.AddNodeID(randID(ln), false)
+		}
+		n.Resize(64)
+		known := n.KnownIDs()
+		for j := 0; j < 500; j++ {
+			n.AddNodeID(randID(ln), false)
+		}
+		assert.True(t, n.KnownIDs() >= known)
+		n.Resize(4)
+		n.tree.root.checkAllowed()
+	}
+}
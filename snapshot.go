@@ -0,0 +1,316 @@
+package dht
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// snapshotMagic starts every snapshot.
+var snapshotMagic = []byte("dhts")
+
+// SnapshotVersion is the version of the format written by Snapshot. Restore can
+// read this version and any earlier version.
+const SnapshotVersion = 4
+
+// Errors returned by Restore
+var (
+	ErrSnapshotFormat  = errors.New("not a dht snapshot")
+	ErrSnapshotVersion = errors.New("unsupported dht snapshot version")
+)
+
+// snapshotContact is the fixed size part of a Contact in a snapshot. It
+// follows the contact's ID and is followed by it's addresses.
+type snapshotContact struct {
+	LastSeen int64
+	Added    int64
+	RTT      int64
+	Failures uint32
+	Flags    uint8
+}
+
+// Flags set on a snapshotContact
+const (
+	snapshotPinned = 1 << iota
+)
+
+// snapshotBan is the fixed size part of a Ban in a snapshot. It follows the
+// ID and is followed by the reason.
+type snapshotBan struct {
+	Created int64
+	TTL     int64
+	Count   uint32
+}
+
+// snapshotPrefixBan is the fixed size part of a PrefixBan in a snapshot. It is
+// followed by the prefix and the reason.
+type snapshotPrefixBan struct {
+	Bits    uint16
+	Created int64
+	TTL     int64
+}
+
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(ns int64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
+
+// Snapshot writes the Node's ID, startBuffers, routing table and blacklist to
+// w so the Node can be restored later.
+//
+// The format is big endian: the magic "dhts", a version byte, the ID length
+// (uint16) and ID, startBuffers (uint32), the number of contacts (uint32)
+// followed by each contact's ID, metadata and addresses (uint16 length prefixed
+// MarshalAddrs), and the number of bans (uint32)
+// followed by each ID, ban details and reason (uint16 length prefixed). All IDs
+// are the same length as the Node's ID. Last is the number of prefix bans
+// (uint32) followed by each ban's details, prefix and reason. Version 1 only
+// held the IDs of the bans, versions before 3 had no prefix bans and versions
+// before 4 had no addresses.
+func (n *Node) Snapshot(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.Write(snapshotMagic)
+	bw.WriteByte(SnapshotVersion)
+	binary.Write(bw, binary.BigEndian, uint16(len(n.id)))
+	bw.Write(n.id)
+	binary.Write(bw, binary.BigEndian, uint32(n.tree.buffers()))
+
+	contacts := n.tree.contacts()
+	binary.Write(bw, binary.BigEndian, uint32(len(contacts)))
+	for _, c := range contacts {
+		bw.Write(c.ID)
+		sc := &snapshotContact{
+			LastSeen: unixNano(c.LastSeen),
+			Added:    unixNano(c.Added),
+			RTT:      int64(c.RTT),
+			Failures: uint32(c.Failures),
+		}
+		if c.Pinned {
+			sc.Flags |= snapshotPinned
+		}
+		binary.Write(bw, binary.BigEndian, sc)
+		addrs := MarshalAddrs(c.Addrs)
+		binary.Write(bw, binary.BigEndian, uint16(len(addrs)))
+		bw.Write(addrs)
+	}
+
+	var bans []*Ban
+	n.blacklist.RLock()
+	for _, b := range n.blacklist.Map {
+		if len(b.ID) == len(n.id) {
+			bans = append(bans, b)
+		}
+	}
+	n.blacklist.RUnlock()
+	binary.Write(bw, binary.BigEndian, uint32(len(bans)))
+	for _, b := range bans {
+		bw.Write(b.ID)
+		binary.Write(bw, binary.BigEndian, &snapshotBan{
+			Created: unixNano(b.Created),
+			TTL:     int64(b.TTL),
+			Count:   uint32(b.Count),
+		})
+		writeString(bw, b.Reason)
+	}
+
+	prefixBans := n.prefixBans.all()
+	binary.Write(bw, binary.BigEndian, uint32(len(prefixBans)))
+	for _, pb := range prefixBans {
+		binary.Write(bw, binary.BigEndian, &snapshotPrefixBan{
+			Bits:    uint16(pb.Bits),
+			Created: unixNano(pb.Created),
+			TTL:     int64(pb.TTL),
+		})
+		bw.Write(pb.Prefix)
+		writeString(bw, pb.Reason)
+	}
+
+	return bw.Flush()
+}
+
+// Restore replaces the Node's ID, startBuffers, routing table and blacklist
+// with those read from a snapshot written by Snapshot. The eviction policy is
+// kept. If an error is returned the Node is not changed. Restore should not be
+// called while the Node is in use by other go routines.
+func (n *Node) Restore(r io.Reader) error {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(snapshotMagic)+1)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return ErrSnapshotFormat
+	}
+	if string(header[:len(snapshotMagic)]) != string(snapshotMagic) {
+		return ErrSnapshotFormat
+	}
+	version := header[len(snapshotMagic)]
+	if version < 1 || version > SnapshotVersion {
+		return ErrSnapshotVersion
+	}
+
+	var idLen uint16
+	if err := binary.Read(br, binary.BigEndian, &idLen); err != nil {
+		return unexpectedEOF(err)
+	}
+	if idLen == 0 {
+		return ErrSnapshotFormat
+	}
+	id := make(NodeID, idLen)
+	if _, err := io.ReadFull(br, id); err != nil {
+		return unexpectedEOF(err)
+	}
+	var startBuffers uint32
+	if err := binary.Read(br, binary.BigEndian, &startBuffers); err != nil {
+		return unexpectedEOF(err)
+	}
+	if startBuffers < 1 {
+		startBuffers = 1
+	}
+	t := newTree(id, int(startBuffers))
+	t.policy = n.tree.policy
+
+	var count uint32
+	if err := binary.Read(br, binary.BigEndian, &count); err != nil {
+		return unexpectedEOF(err)
+	}
+	for i := uint32(0); i < count; i++ {
+		c := &Contact{
+			ID: make(NodeID, idLen),
+		}
+		if _, err := io.ReadFull(br, c.ID); err != nil {
+			return unexpectedEOF(err)
+		}
+		var sc snapshotContact
+		if err := binary.Read(br, binary.BigEndian, &sc); err != nil {
+			return unexpectedEOF(err)
+		}
+		c.LastSeen = fromUnixNano(sc.LastSeen)
+		c.Added = fromUnixNano(sc.Added)
+		c.RTT = time.Duration(sc.RTT)
+		c.Failures = int(sc.Failures)
+		c.Pinned = sc.Flags&snapshotPinned != 0
+		if version >= 4 {
+			var ln uint16
+			if err := binary.Read(br, binary.BigEndian, &ln); err != nil {
+				return unexpectedEOF(err)
+			}
+			addrs := make([]byte, ln)
+			if _, err := io.ReadFull(br, addrs); err != nil {
+				return unexpectedEOF(err)
+			}
+			var err error
+			if c.Addrs, err = UnmarshalAddrs(addrs); err != nil {
+				return ErrSnapshotFormat
+			}
+		}
+		if !c.ID.Equal(id) {
+			t.insertContact(c)
+		}
+	}
+	t.prune()
+
+	bl := newblacklist()
+	if err := binary.Read(br, binary.BigEndian, &count); err != nil {
+		return unexpectedEOF(err)
+	}
+	now := time.Now()
+	for i := uint32(0); i < count; i++ {
+		b := &Ban{
+			ID: make(NodeID, idLen),
+		}
+		if _, err := io.ReadFull(br, b.ID); err != nil {
+			return unexpectedEOF(err)
+		}
+		if version == 1 {
+			b.Reason = "restored"
+			b.Created = now
+			b.TTL = banTTL(1)
+			b.Count = 1
+		} else {
+			var sb snapshotBan
+			if err := binary.Read(br, binary.BigEndian, &sb); err != nil {
+				return unexpectedEOF(err)
+			}
+			b.Created = fromUnixNano(sb.Created)
+			b.TTL = time.Duration(sb.TTL)
+			b.Count = int(sb.Count)
+			var err error
+			if b.Reason, err = readString(br); err != nil {
+				return unexpectedEOF(err)
+			}
+		}
+		bl.Map[b.ID.String()] = b
+	}
+
+	pbs := newPrefixBans()
+	if version >= 3 {
+		if err := binary.Read(br, binary.BigEndian, &count); err != nil {
+			return unexpectedEOF(err)
+		}
+		for i := uint32(0); i < count; i++ {
+			var spb snapshotPrefixBan
+			if err := binary.Read(br, binary.BigEndian, &spb); err != nil {
+				return unexpectedEOF(err)
+			}
+			if uint(spb.Bits) > uint(idLen)*8 {
+				return ErrSnapshotFormat
+			}
+			pb := &PrefixBan{
+				Prefix:  make(NodeID, (spb.Bits+7)/8),
+				Bits:    uint(spb.Bits),
+				Created: fromUnixNano(spb.Created),
+				TTL:     time.Duration(spb.TTL),
+			}
+			if _, err := io.ReadFull(br, pb.Prefix); err != nil {
+				return unexpectedEOF(err)
+			}
+			var err error
+			if pb.Reason, err = readString(br); err != nil {
+				return unexpectedEOF(err)
+			}
+			pbs.add(pb)
+		}
+	}
+
+	n.id = id
+	n.tree = t
+	n.blacklist = bl
+	n.prefixBans = pbs
+	return nil
+}
+
+func writeString(w io.Writer, s string) {
+	if len(s) > 0xffff {
+		s = s[:0xffff]
+	}
+	binary.Write(w, binary.BigEndian, uint16(len(s)))
+	io.WriteString(w, s)
+}
+
+func readString(r io.Reader) (string, error) {
+	var ln uint16
+	if err := binary.Read(r, binary.BigEndian, &ln); err != nil {
+		return "", err
+	}
+	b := make([]byte, ln)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,96 @@
+package dht
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	n := New([]byte{5, 4, 3}, 8, nil)
+	seen := time.Now()
+	n.AddContact(Contact{
+		ID:       NodeID{128, 100, 123},
+		LastSeen: seen,
+		RTT:      15 * time.Millisecond,
+	}, false)
+	n.AddNodeID(NodeID{32, 100, 123}, false)
+	n.Failed(NodeID{32, 100, 123})
+	n.RemoveNodeID(NodeID{64, 1, 2}, true)
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, n.Snapshot(buf))
+
+	r := New([]byte{1, 1, 1}, 2, nil)
+	assert.NoError(t, r.Restore(buf))
+	assert.Equal(t, n.ID(), r.ID())
+	assert.Equal(t, 8, r.StartBuffers())
+	assert.Equal(t, 2, r.KnownIDs())
+
+	c, ok := r.Contact(NodeID{128, 100, 123})
+	assert.True(t, ok)
+	assert.True(t, seen.Equal(c.LastSeen))
+	assert.Equal(t, 15*time.Millisecond, c.RTT)
+	orig, _ := n.Contact(NodeID{128, 100, 123})
+	assert.True(t, orig.Added.Equal(c.Added))
+
+	c, ok = r.Contact(NodeID{32, 100, 123})
+	assert.True(t, ok)
+	assert.True(t, c.LastSeen.IsZero())
+	assert.Equal(t, 1, c.Failures)
+
+	bans := r.Bans()
+	assert.Len(t, bans, 1)
+	assert.Equal(t, NodeID{64, 1, 2}, bans[0].ID)
+	assert.Equal(t, "removed", bans[0].Reason)
+	assert.Equal(t, BanTTL, bans[0].TTL)
+	r.AddNodeID(NodeID{64, 1, 2}, false)
+	assert.Equal(t, 2, r.KnownIDs())
+}
+
+func TestRestoreVersion1(t *testing.T) {
+	b := append([]byte{}, snapshotMagic...)
+	b = append(b, 1,
+		0, 3, 5, 4, 3, // id
+		0, 0, 0, 8, // startBuffers
+		0, 0, 0, 1, // contacts
+		128, 100, 123,
+		0, 0, 0, 0, 0, 0, 0, 0, // LastSeen
+		0, 0, 0, 0, 0, 0, 0, 0, // Added
+		0, 0, 0, 0, 0, 0, 0, 0, // RTT
+		0, 0, 0, 2, // Failures
+		0,          // Flags
+		0, 0, 0, 1, // blacklist
+		64, 1, 2,
+	)
+	n := New([]byte{1, 1, 1}, 2, nil)
+	assert.NoError(t, n.Restore(bytes.NewReader(b)))
+	assert.Equal(t, NodeID{5, 4, 3}, n.ID())
+	c, ok := n.Contact(NodeID{128, 100, 123})
+	assert.True(t, ok)
+	assert.Equal(t, 2, c.Failures)
+	bans := n.Bans()
+	assert.Len(t, bans, 1)
+	assert.Equal(t, NodeID{64, 1, 2}, bans[0].ID)
+}
+
+func TestRestoreErrors(t *testing.T) {
+	n := New([]byte{5, 4, 3}, 8, nil)
+	n.AddNodeID(NodeID{128, 100, 123}, false)
+	buf := &bytes.Buffer{}
+	assert.NoError(t, n.Snapshot(buf))
+	b := buf.Bytes()
+
+	r := New([]byte{1, 1, 1}, 2, nil)
+	assert.Equal(t, ErrSnapshotFormat, r.Restore(bytes.NewReader([]byte("nope!"))))
+
+	bad := append([]byte{}, b...)
+	bad[len(snapshotMagic)] = SnapshotVersion + 1
+	assert.Equal(t, ErrSnapshotVersion, r.Restore(bytes.NewReader(bad)))
+
+	assert.Equal(t, io.ErrUnexpectedEOF, r.Restore(bytes.NewReader(b[:len(b)-2])))
+	assert.Equal(t, NodeID{1, 1, 1}, r.ID())
+	assert.Equal(t, 0, r.KnownIDs())
+}